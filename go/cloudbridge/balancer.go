@@ -0,0 +1,273 @@
+package cloudbridge
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Balancer chooses among the healthy instances of a service for
+// DialService. Implementations must be safe for concurrent use.
+type Balancer interface {
+	// Pick returns the instances to try, most preferred first. key is the
+	// value given with WithHashKey, if any.
+	Pick(instances []Service, key string) []Service
+}
+
+// DialObserver is implemented by balancers that learn from the dials made
+// with them
+type DialObserver interface {
+	// ObserveDial reports a connection attempt to an instance and how long
+	// it took
+	ObserveDial(instance Service, rtt time.Duration, err error)
+
+	// ObserveClose reports that a connection to an instance was closed
+	ObserveClose(instance Service)
+}
+
+// instanceKey identifies a service instance across peers
+func instanceKey(s Service) string {
+	return s.PeerID + "/" + s.ID
+}
+
+// roundRobinBalancer rotates through the instances of each service
+type roundRobinBalancer struct {
+	mu   sync.Mutex
+	next map[string]int // by service name
+}
+
+// NewRoundRobinBalancer returns a balancer that takes turns among the
+// instances of each service
+func NewRoundRobinBalancer() Balancer {
+	return &roundRobinBalancer{next: make(map[string]int)}
+}
+
+// Pick rotates instances by one on every call
+func (b *roundRobinBalancer) Pick(instances []Service, key string) []Service {
+	if len(instances) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	name := instances[0].Name
+	start := b.next[name] % len(instances)
+	b.next[name] = start + 1
+	b.mu.Unlock()
+
+	return rotate(instances, start)
+}
+
+// rotate returns instances starting at index start and wrapping around
+func rotate(instances []Service, start int) []Service {
+	ordered := make([]Service, 0, len(instances))
+	ordered = append(ordered, instances[start:]...)
+	return append(ordered, instances[:start]...)
+}
+
+// leastConnBalancer prefers the instances with the fewest open connections
+type leastConnBalancer struct {
+	rr    roundRobinBalancer // spreads instances with equal counts
+	mu    sync.Mutex
+	conns map[string]int // by instance key
+}
+
+// NewLeastConnectionsBalancer returns a balancer that prefers the instances
+// with the fewest connections opened through it
+func NewLeastConnectionsBalancer() Balancer {
+	return &leastConnBalancer{
+		rr:    roundRobinBalancer{next: make(map[string]int)},
+		conns: make(map[string]int),
+	}
+}
+
+// Pick orders instances by open connections
+func (b *leastConnBalancer) Pick(instances []Service, key string) []Service {
+	ordered := b.rr.Pick(instances, key)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return b.conns[instanceKey(ordered[i])] < b.conns[instanceKey(ordered[j])]
+	})
+	return ordered
+}
+
+// ObserveDial counts the new connection
+func (b *leastConnBalancer) ObserveDial(instance Service, rtt time.Duration, err error) {
+	if err != nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.conns[instanceKey(instance)]++
+}
+
+// ObserveClose uncounts the connection
+func (b *leastConnBalancer) ObserveClose(instance Service) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	k := instanceKey(instance)
+	if b.conns[k] <= 1 {
+		delete(b.conns, k)
+		return
+	}
+	b.conns[k]--
+}
+
+// Latency balancer tuning
+const (
+	// latencySmoothing is the weight of a new sample in the average RTT
+	latencySmoothing = 0.3
+
+	// latencyFailurePenalty is recorded as the RTT of a failed dial
+	latencyFailurePenalty = 5 * time.Second
+)
+
+// latencyBalancer favours instances with a low average dial RTT
+type latencyBalancer struct {
+	mu  sync.Mutex
+	rtt map[string]time.Duration // moving average by instance key
+}
+
+// NewLatencyBalancer returns a balancer that picks instances at random,
+// weighted by the inverse of their average dial round-trip time. Instances
+// without measurements are tried first so that they get measured.
+func NewLatencyBalancer() Balancer {
+	return &latencyBalancer{rtt: make(map[string]time.Duration)}
+}
+
+// Pick orders instances by weighted random sampling
+func (b *latencyBalancer) Pick(instances []Service, key string) []Service {
+	b.mu.Lock()
+	var unmeasured, measured []Service
+	var weights []float64
+	for _, s := range instances {
+		rtt, ok := b.rtt[instanceKey(s)]
+		if !ok {
+			unmeasured = append(unmeasured, s)
+			continue
+		}
+		measured = append(measured, s)
+		weights = append(weights, 1/max(rtt.Seconds(), 1e-6))
+	}
+	b.mu.Unlock()
+
+	ordered := make([]Service, 0, len(instances))
+	ordered = append(ordered, unmeasured...)
+	for len(measured) > 0 {
+		total := 0.0
+		for _, w := range weights {
+			total += w
+		}
+
+		i, r := 0, rand.Float64()*total
+		for ; i < len(weights)-1; i++ {
+			if r -= weights[i]; r < 0 {
+				break
+			}
+		}
+
+		ordered = append(ordered, measured[i])
+		measured = append(measured[:i], measured[i+1:]...)
+		weights = append(weights[:i], weights[i+1:]...)
+	}
+	return ordered
+}
+
+// ObserveDial folds the dial time into the instance's average
+func (b *latencyBalancer) ObserveDial(instance Service, rtt time.Duration, err error) {
+	if err != nil {
+		rtt = latencyFailurePenalty
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	k := instanceKey(instance)
+	if avg, ok := b.rtt[k]; ok {
+		rtt = avg + time.Duration(latencySmoothing*float64(rtt-avg))
+	}
+	b.rtt[k] = rtt
+}
+
+// ObserveClose does nothing; only dial times matter
+func (b *latencyBalancer) ObserveClose(instance Service) {}
+
+// hashBalancer maps keys to instances by rendezvous hashing
+type hashBalancer struct{}
+
+// NewConsistentHashBalancer returns a balancer that sends every key given
+// with WithHashKey to the same instance while it is available. When
+// instances come and go, only the keys of the affected instances move.
+func NewConsistentHashBalancer() Balancer {
+	return hashBalancer{}
+}
+
+// Pick orders instances by their hash score for key
+func (hashBalancer) Pick(instances []Service, key string) []Service {
+	scores := make(map[string]uint64, len(instances))
+	for _, s := range instances {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(instanceKey(s)))
+		scores[instanceKey(s)] = h.Sum64()
+	}
+
+	ordered := append([]Service(nil), instances...)
+	sort.Slice(ordered, func(i, j int) bool {
+		return scores[instanceKey(ordered[i])] > scores[instanceKey(ordered[j])]
+	})
+	return ordered
+}
+
+// regionBalancer prefers instances in one region
+type regionBalancer struct {
+	region string
+	next   Balancer
+}
+
+// NewRegionBalancer returns a balancer that chooses among the instances
+// whose Metadata["region"] is region with next (default: round robin). The
+// other instances are used only if none in the region is left, or as
+// fallbacks after them.
+func NewRegionBalancer(region string, next Balancer) Balancer {
+	if next == nil {
+		next = NewRoundRobinBalancer()
+	}
+	return &regionBalancer{region: region, next: next}
+}
+
+// Pick balances the instances in the region and appends the others
+func (b *regionBalancer) Pick(instances []Service, key string) []Service {
+	var near, far []Service
+	for _, s := range instances {
+		if s.Metadata["region"] == b.region {
+			near = append(near, s)
+		} else {
+			far = append(far, s)
+		}
+	}
+
+	if len(near) == 0 {
+		return b.next.Pick(far, key)
+	}
+	return append(b.next.Pick(near, key), far...)
+}
+
+// ObserveDial passes the dial on to the inner balancer
+func (b *regionBalancer) ObserveDial(instance Service, rtt time.Duration, err error) {
+	if o, ok := b.next.(DialObserver); ok {
+		o.ObserveDial(instance, rtt, err)
+	}
+}
+
+// ObserveClose passes the close on to the inner balancer
+func (b *regionBalancer) ObserveClose(instance Service) {
+	if o, ok := b.next.(DialObserver); ok {
+		o.ObserveClose(instance)
+	}
+}
@@ -0,0 +1,223 @@
+package cloudbridge
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// instances returns one "api" instance per peer
+func instances(peers ...string) []Service {
+	var services []Service
+	for _, peer := range peers {
+		services = append(services, Service{ID: "api-" + peer, Name: "api", PeerID: peer, Healthy: true})
+	}
+	return services
+}
+
+// firstPeers returns the peer of the first instance picked by each call
+func firstPeers(b Balancer, services []Service, key string, calls int) []string {
+	var peers []string
+	for i := 0; i < calls; i++ {
+		peers = append(peers, b.Pick(services, key)[0].PeerID)
+	}
+	return peers
+}
+
+func TestBalancerPick(t *testing.T) {
+	tests := []struct {
+		name     string
+		balancer func() Balancer
+		services []Service
+		want     []string // first peer of successive picks
+	}{
+		{
+			name:     "round robin",
+			balancer: NewRoundRobinBalancer,
+			services: instances("a", "b", "c"),
+			want:     []string{"a", "b", "c", "a"},
+		},
+		{
+			name: "least connections",
+			balancer: func() Balancer {
+				b := NewLeastConnectionsBalancer()
+				b.(DialObserver).ObserveDial(instances("a")[0], 0, nil)
+				b.(DialObserver).ObserveDial(instances("b")[0], 0, nil)
+				b.(DialObserver).ObserveDial(instances("b")[0], 0, errors.New("refused"))
+				return b
+			},
+			services: instances("a", "b", "c"),
+			want:     []string{"c", "c"},
+		},
+		{
+			name: "region affinity",
+			balancer: func() Balancer {
+				return NewRegionBalancer("eu-central", nil)
+			},
+			services: []Service{
+				{ID: "1", PeerID: "a", Metadata: map[string]string{"region": "us-east"}},
+				{ID: "2", PeerID: "b", Metadata: map[string]string{"region": "eu-central"}},
+				{ID: "3", PeerID: "c", Metadata: map[string]string{"region": "eu-central"}},
+			},
+			want: []string{"b", "c", "b"},
+		},
+		{
+			name: "region affinity without local instances",
+			balancer: func() Balancer {
+				return NewRegionBalancer("ap-south", nil)
+			},
+			services: instances("a", "b"),
+			want:     []string{"a", "b", "a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := firstPeers(tt.balancer(), tt.services, "", len(tt.want))
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("Pick() first peers = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestLeastConnectionsClose(t *testing.T) {
+	b := NewLeastConnectionsBalancer()
+	observer := b.(DialObserver)
+	services := instances("a", "b")
+
+	observer.ObserveDial(services[0], 0, nil)
+	observer.ObserveDial(services[1], 0, nil)
+	observer.ObserveDial(services[1], 0, nil)
+	observer.ObserveClose(services[1])
+	observer.ObserveClose(services[1])
+
+	if got := b.Pick(services, "")[0].PeerID; got != "b" {
+		t.Errorf("Pick() after closes = %s first, want b", got)
+	}
+}
+
+func TestLatencyBalancer(t *testing.T) {
+	b := NewLatencyBalancer()
+	observer := b.(DialObserver)
+	services := instances("fast", "slow", "new")
+
+	observer.ObserveDial(services[0], time.Millisecond, nil)
+	observer.ObserveDial(services[1], 100*time.Millisecond, nil)
+
+	if got := b.Pick(services, "")[0].PeerID; got != "new" {
+		t.Errorf("Pick() = %s first, want the unmeasured instance", got)
+	}
+
+	counts := make(map[string]int)
+	for _, peer := range firstPeers(b, services[:2], "", 200) {
+		counts[peer]++
+	}
+	if counts["fast"] < 150 {
+		t.Errorf("Pick() chose the fast instance %d of 200 times, want most", counts["fast"])
+	}
+
+	// A failed dial makes an instance look slow
+	observer.ObserveDial(services[0], 0, errors.New("refused"))
+	counts = make(map[string]int)
+	for _, peer := range firstPeers(b, services[:2], "", 200) {
+		counts[peer]++
+	}
+	if counts["slow"] < 150 {
+		t.Errorf("Pick() chose the slow instance %d of 200 times after a failure, want most", counts["slow"])
+	}
+}
+
+func TestConsistentHashBalancer(t *testing.T) {
+	b := NewConsistentHashBalancer()
+	services := instances("a", "b", "c", "d")
+
+	chosen := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		key := "user-" + strconv.Itoa(i)
+		chosen[key] = b.Pick(services, key)[0].PeerID
+		if again := b.Pick(services, key)[0].PeerID; again != chosen[key] {
+			t.Fatalf("Pick(%s) = %s, then %s", key, chosen[key], again)
+		}
+	}
+
+	used := make(map[string]bool)
+	for _, peer := range chosen {
+		used[peer] = true
+	}
+	if len(used) < 3 {
+		t.Errorf("Pick() spread 50 keys over %d instances", len(used))
+	}
+
+	// Removing an instance only moves its own keys
+	remaining := instances("a", "b", "c")
+	for key, peer := range chosen {
+		got := b.Pick(remaining, key)[0].PeerID
+		if peer != "d" && got != peer {
+			t.Errorf("Pick(%s) moved from %s to %s", key, peer, got)
+		}
+	}
+}
+
+func TestDialServiceLocal(t *testing.T) {
+	client, _ := newPipeClient(t)
+	ctx := context.Background()
+
+	if _, err := client.DialService(ctx, "api"); err == nil {
+		t.Error("DialService() without instances error = nil, want error")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("hi"))
+			conn.Close()
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	if err := client.RegisterService(ctx, ServiceConfig{Name: "api", Port: port}); err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+
+	b := NewLeastConnectionsBalancer()
+	conn, err := client.DialService(ctx, "api", WithBalancer(b))
+	if err != nil {
+		t.Fatalf("DialService() error = %v", err)
+	}
+	if data, _ := io.ReadAll(conn); string(data) != "hi" {
+		t.Errorf("read %q, want %q", data, "hi")
+	}
+
+	lb := b.(*leastConnBalancer)
+	lb.mu.Lock()
+	open := len(lb.conns)
+	lb.mu.Unlock()
+	if open != 1 {
+		t.Errorf("balancer counts %d instances with connections, want 1", open)
+	}
+
+	conn.Close()
+	conn.Close()
+	lb.mu.Lock()
+	open = len(lb.conns)
+	lb.mu.Unlock()
+	if open != 0 {
+		t.Errorf("balancer counts %d instances with connections after Close, want 0", open)
+	}
+}
@@ -1,26 +1,39 @@
 package cloudbridge
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"slices"
 	"sync"
 	"time"
 
-	quicgo "github.com/quic-go/quic-go"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/internal/jwt"
 )
 
 // Client represents a CloudBridge SDK client
 type Client struct {
 	config    *Config
-	transport *transport
-	conn      *connection
+	transport Transport
+	conns     *connRegistry
+	sessions  *sessionRegistry
 	mu        sync.RWMutex
 	closed    bool
-	services  map[string]Service
+	registry  *serviceRegistry
+	handlers  map[string]func(Connection)
+	listeners map[*listener]struct{}
+	meshes    map[*mesh]struct{} // joined, receiving mesh messages
+	tenantID  string             // from the token, sent in handshakes
+	inbound   *tunnelLimiter     // caps the tunnels served for peers
+	balancer  Balancer           // default for DialService
+	done      chan struct{}      // closed by Close
+
+	// Sessions opened with Dial by peers, waiting for AcceptSession
+	incomingSessions chan *session
+	sessionSlots     chan struct{}
 
 	// Callbacks
 	onConnect    func(peer string)
@@ -42,10 +55,36 @@ func NewClient(opts ...Option) (*Client, error) {
 
 	client := &Client{
 		config:       config,
-		services:     make(map[string]Service),
+		conns:        newConnRegistry(),
+		sessions:     newSessionRegistry(),
+		handlers:     make(map[string]func(Connection)),
+		listeners:    make(map[*listener]struct{}),
+		meshes:       make(map[*mesh]struct{}),
+		inbound:      newTunnelLimiter(config.InboundTunnelLimits),
+		balancer:     NewRoundRobinBalancer(),
+		done:         make(chan struct{}),
 		onConnect:    config.OnConnect,
 		onDisconnect: config.OnDisconnect,
 		onReconnect:  config.OnReconnect,
+
+		incomingSessions: make(chan *session, sessionBacklog),
+		sessionSlots:     make(chan struct{}, sessionBacklog),
+	}
+
+	// Tokens without a tenant_id claim identify the peer by ID only
+	client.tenantID, _ = jwt.ExtractTenantID(config.Token)
+	client.registry = newServiceRegistry(client)
+
+	if config.Transport != nil {
+		client.transport = config.Transport
+		client.startRegistry()
+		return client, nil
+	}
+
+	// The relay does not identify the peers that open streams, so rules
+	// naming peers would never apply
+	if config.TunnelPolicy != nil && config.TunnelPolicy.namesPeers() {
+		return nil, errors.New("invalid tunnel policy: the relay transport cannot identify peers, so rules may only use \"*\"")
 	}
 
 	// Initialize transport
@@ -60,10 +99,59 @@ func NewClient(opts ...Option) (*Client, error) {
 	if err := tr.initialize(ctx); err != nil {
 		return nil, fmt.Errorf("failed to initialize transport: %w", err)
 	}
+	client.startRegistry()
 
 	return client, nil
 }
 
+// startRegistry receives service announcements from the mesh and asks
+// peers for their current services in the background, so that a slow
+// mesh does not hold up NewClient
+func (c *Client) startRegistry() {
+	if t, ok := c.transport.(senderClaimingTransport); ok {
+		t.setClaimedMessageHandler(c.handleMessage)
+	} else {
+		c.transport.SetMessageHandler(func(peerID string, data []byte) {
+			c.handleMessage(peerID, peerID, data)
+		})
+	}
+	go c.registry.sweepLoop()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+		defer cancel()
+		c.registry.sync(ctx)
+	}()
+}
+
+// senderClaimingTransport is implemented by transports that cannot
+// identify the sender of a mesh message but pass on the peer ID it claims
+type senderClaimingTransport interface {
+	setClaimedMessageHandler(handler func(peerID, sender string, data []byte))
+}
+
+// handleMessage passes registry messages to the service registry and all
+// other mesh messages to the joined meshes. peerID is the sender as
+// identified by the transport, which the registry relies on; sender is
+// reported as Message.From, and may only be claimed.
+func (c *Client) handleMessage(peerID, sender string, data []byte) {
+	if bytes.HasPrefix(data, []byte(registryMagic)) {
+		c.registry.handleMessage(peerID, data)
+		return
+	}
+
+	c.mu.RLock()
+	meshes := make([]*mesh, 0, len(c.meshes))
+	for m := range c.meshes {
+		meshes = append(meshes, m)
+	}
+	c.mu.RUnlock()
+
+	for _, m := range meshes {
+		m.deliver(Message{From: sender, Data: data})
+	}
+}
+
 // Connect establishes a P2P connection to the specified peer
 func (c *Client) Connect(ctx context.Context, peerID string) (Connection, error) {
 	c.mu.RLock()
@@ -77,17 +165,39 @@ func (c *Client) Connect(ctx context.Context, peerID string) (Connection, error)
 		return nil, errors.New("peer ID cannot be empty")
 	}
 
-	// Use transport to connect
-	conn, err := c.transport.connectToPeer(ctx, peerID)
+	return c.connect(ctx, peerID, c.config.RetryPolicy, func(ctx context.Context) (Stream, error) {
+		return c.transport.ConnectToPeer(ctx, peerID)
+	})
+}
+
+// connect opens a stream with dial and wraps it in a registered connection.
+// dial is also used to replace the stream when the connection reconnects
+// according to retry.
+func (c *Client) connect(ctx context.Context, peerID string, retry RetryPolicy, dial func(ctx context.Context) (Stream, error)) (Connection, error) {
+	stream, err := dial(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to peer %s: %w", peerID, err)
 	}
-	conn.client = c
-	c.conn = conn
 
-	if c.onConnect != nil {
-		c.onConnect(peerID)
-	}
+	connCtx, cancel := context.WithCancel(context.Background())
+	conn := &connection{
+		peerID:      peerID,
+		localPeerID: c.transport.LocalPeerID(),
+		client:      c,
+		connected:   true,
+		connectedAt: time.Now(),
+		bridgeConn:  stream,
+		retry:       retry,
+		ctx:         connCtx,
+		cancel:      cancel,
+		redial: func(ctx context.Context) (Stream, error) {
+			dialCtx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+			defer cancel()
+			return dial(dialCtx)
+		},
+	}
+	c.conns.add(conn)
+	c.notifyConnect(peerID)
 
 	return conn, nil
 }
@@ -140,6 +250,10 @@ func (c *Client) JoinMesh(ctx context.Context, networkName string) (Mesh, error)
 		return nil, fmt.Errorf("failed to join mesh network %s: %w", networkName, err)
 	}
 
+	c.mu.Lock()
+	c.meshes[mesh] = struct{}{}
+	c.mu.Unlock()
+
 	return mesh, nil
 }
 
@@ -156,28 +270,34 @@ func (c *Client) RegisterService(ctx context.Context, config ServiceConfig) erro
 		return fmt.Errorf("invalid service configuration: %w", err)
 	}
 
-	// Store service locally
-	serviceID := fmt.Sprintf("%s-%s-%d", config.Name, c.config.Region, config.Port)
+	// The peer ID keeps IDs unique across peers in the same region
+	peerID := c.transport.LocalPeerID()
+	serviceID := fmt.Sprintf("%s-%s-%d", config.Name, peerID, config.Port)
+
+	// Metadata defaults to the client region so that it can be queried
+	metadata := map[string]string{"region": c.config.Region}
+	for k, v := range config.Metadata {
+		metadata[k] = v
+	}
+
 	service := Service{
 		ID:       serviceID,
 		Name:     config.Name,
 		Port:     config.Port,
-		Tags:     config.Tags,
-		Healthy:  true,
-		PeerID:   c.transport.bridge.GetPeerID(),
-		Metadata: map[string]string{"region": c.config.Region},
+		Tags:     slices.Clone(config.Tags),
+		Version:  config.Version,
+		PeerID:   peerID,
+		Metadata: metadata,
 	}
 
-	c.services[serviceID] = service
-	
-	// TODO: Broadcast service registration to mesh
-	// c.transport.broadcast(...)
+	// Store the service and announce it to the mesh
+	c.registry.register(ctx, serviceRecord{Service: service, TTL: config.TTL}, config.HealthCheck)
 
 	return nil
 }
 
 // DiscoverServices discovers services by name
-func (c *Client) DiscoverServices(ctx context.Context, serviceName string) ([]Service, error) {
+func (c *Client) DiscoverServices(ctx context.Context, serviceName string, opts ...DiscoverOption) ([]Service, error) {
 	c.mu.RLock()
 	if c.closed {
 		c.mu.RUnlock()
@@ -189,34 +309,57 @@ func (c *Client) DiscoverServices(ctx context.Context, serviceName string) ([]Se
 		return nil, errors.New("service name cannot be empty")
 	}
 
-	// Return local services matching the name
-	var services []Service
-	for _, s := range c.services {
-		if s.Name == serviceName {
-			services = append(services, s)
-		}
+	var config discoverConfig
+	for _, opt := range opts {
+		opt(&config)
 	}
 
-	// TODO: Query remote peers for services
+	return c.registry.lookup(DiscoverServicesQuery{Name: serviceName, HealthyOnly: config.healthyOnly}), nil
+}
+
+// QueryServices discovers the services matching q, on this client and
+// on every peer in the tenant. It reads the local replica of the registry
+// without contacting peers, so registrations still being replicated are
+// not seen yet.
+func (c *Client) QueryServices(ctx context.Context, q DiscoverServicesQuery) ([]Service, error) {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return nil, errors.New("client is closed")
+	}
+	c.mu.RUnlock()
 
-	return services, nil
+	return c.registry.lookup(q), nil
+}
+
+// WatchServices reports changes to the services named serviceName, starting
+// with the current ones as added. The channel is closed when ctx ends or the
+// client is closed.
+func (c *Client) WatchServices(ctx context.Context, serviceName string) (<-chan ServiceEvent, error) {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return nil, errors.New("client is closed")
+	}
+	c.mu.RUnlock()
+
+	if serviceName == "" {
+		return nil, errors.New("service name cannot be empty")
+	}
+
+	return c.registry.watch(ctx, serviceName)
 }
 
 // DeregisterService deregisters a service
 func (c *Client) DeregisterService(ctx context.Context, serviceID string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
+	c.mu.RLock()
 	if c.closed {
+		c.mu.RUnlock()
 		return errors.New("client is closed")
 	}
+	c.mu.RUnlock()
 
-	if _, exists := c.services[serviceID]; !exists {
-		return fmt.Errorf("service not found: %s", serviceID)
-	}
-
-	delete(c.services, serviceID)
-	return nil
+	return c.registry.deregister(ctx, serviceID)
 }
 
 // Health checks the health of the client connection
@@ -228,15 +371,13 @@ func (c *Client) Health(ctx context.Context) (*Health, error) {
 	}
 	c.mu.RUnlock()
 
-	peers := 0
-	if c.conn != nil {
-		peers = 1
-	}
+	counts := c.conns.peerCounts()
 
 	return &Health{
-		Status:         "healthy",
-		Latency:        15 * time.Millisecond, // TODO: Get actual latency from transport
-		ConnectedPeers: peers,
+		Status:          "healthy",
+		Latency:         15 * time.Millisecond, // TODO: Get actual latency from transport
+		ConnectedPeers:  len(counts),
+		PeerConnections: counts,
 	}, nil
 }
 
@@ -249,10 +390,9 @@ func (c *Client) Serve(ctx context.Context) error {
 	}
 	c.mu.RUnlock()
 
-	// Register stream handler with the bridge
-	c.transport.bridge.SetStreamHandler(func(stream *quicgo.Stream) {
-		// Type assert and handle incoming connection
-		c.HandleIncomingConnection(stream)
+	// Register stream handler with the transport
+	c.transport.SetStreamHandler(func(peerID string, stream Stream) {
+		c.handleStream(stream, peerID)
 	})
 
 	// Block until context is done
@@ -261,52 +401,157 @@ func (c *Client) Serve(ctx context.Context) error {
 }
 
 // HandleIncomingConnection handles an incoming P2P connection
-// This should be called by the transport when a new stream is accepted
+// This should be called by the transport when a new stream is accepted.
+// The remote peer is unidentified, so tunnel policy rules that name peers
+// do not apply to it; Serve passes on the peer the transport authenticated.
 func (c *Client) HandleIncomingConnection(conn interface{}) {
-	// Type assert to net.Conn or quic.Stream
-	netConn, ok := conn.(net.Conn)
+	// Accept net.Conn, quic streams and any other transport stream
+	netConn, ok := conn.(io.ReadWriteCloser)
 	if !ok {
-		// Try to handle as a generic io.ReadWriteCloser
-		fmt.Printf("received non-net.Conn connection: %T\n", conn)
+		fmt.Printf("received unsupported connection type: %T\n", conn)
 		return
 	}
 
-	go func() {
-		defer netConn.Close()
+	c.handleStream(netConn, "")
+}
 
-		// Read handshake
-		buf := make([]byte, 1024)
-		n, err := netConn.Read(buf)
-		if err != nil {
-			fmt.Printf("failed to read handshake: %v\n", err)
-			return
-		}
+// handleStream serves an incoming stream from peerID, the peer the transport
+// authenticated, or "" if it did not identify the peer
+func (c *Client) handleStream(netConn io.ReadWriteCloser, peerID string) {
+	go c.serveStream(netConn, peerID, nil)
+}
 
-		var handshake struct {
-			Type string `json:"type"`
-			Port int    `json:"port"`
+// serveStream reads the handshake of an incoming stream from peerID and
+// serves it according to its kind. s is the session the stream was opened
+// in, if any; the peer of a session this client dialed may only open
+// streams for AcceptStream.
+func (c *Client) serveStream(netConn io.ReadWriteCloser, peerID string, s *session) {
+	// Protocol handlers and sessions take ownership of the stream
+	owned := false
+	defer func() {
+		if !owned {
+			netConn.Close()
 		}
+	}()
 
-		if err := json.Unmarshal(buf[:n], &handshake); err != nil {
-			// Not a tunnel handshake, treat as generic app connection
-			// TODO: Handle generic app connection
+	clearDeadline := setHandshakeDeadline(netConn, c.config.Timeout)
+	req, err := readHandshake(netConn)
+	clearDeadline()
+	if err != nil {
+		var hsErr *HandshakeError
+		if errors.As(err, &hsErr) {
+			rejectHandshake(netConn, hsErr.Code, hsErr.Message)
 			return
 		}
+		fmt.Printf("failed to read handshake: %v\n", err)
+		return
+	}
+
+	// The peer ID in the handshake is only a claim
+	if claimed := req.Metadata[metaPeerID]; peerID != "" && claimed != "" && claimed != peerID {
+		fmt.Printf("peer %q claimed to be %q\n", peerID, claimed)
+		rejectHandshake(netConn, HandshakeUnauthorized, "peer ID does not match the transport")
+		return
+	}
 
-		if handshake.Type == "tunnel" {
-			// Connect to local service
-			localConn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", handshake.Port))
-			if err != nil {
-				fmt.Printf("failed to connect to local service on port %d: %v\n", handshake.Port, err)
-				return
-			}
-			defer localConn.Close()
-
-			// Bidirectional copy
-			go io.Copy(localConn, netConn)
-			io.Copy(netConn, localConn)
+	if s != nil && s.dialed && req.Kind != StreamKindStream {
+		rejectHandshake(netConn, HandshakeUnsupportedKind, req.Kind.String())
+		return
+	}
+
+	switch req.Kind {
+	case StreamKindSession:
+		c.serveSession(netConn, req, peerID, remotePeer(peerID, req))
+	case StreamKindStream:
+		if s == nil {
+			rejectHandshake(netConn, HandshakeUnsupportedKind, "stream outside a session")
+			return
 		}
-	}()
+		owned = s.serveSessionStream(netConn)
+	case StreamKindTunnel:
+		c.serveTunnel(netConn, req, peerID)
+	case StreamKindUDP:
+		c.serveUDP(netConn, req, peerID)
+	case StreamKindReverse:
+		c.serveReverse(netConn, req, peerID)
+	case StreamKindProtocol:
+		owned = c.serveProtocol(netConn, req, remotePeer(peerID, req))
+	default:
+		rejectHandshake(netConn, HandshakeUnsupportedKind, req.Kind.String())
+	}
+}
+
+// remotePeer returns the peer ID to report for an incoming stream: the one
+// the transport authenticated, or else the one claimed in the handshake. It
+// must not be used for access decisions.
+func remotePeer(peerID string, req handshakeRequest) string {
+	if peerID != "" {
+		return peerID
+	}
+	return req.Metadata[metaPeerID]
+}
+
+// serveTunnel connects an incoming tunnel stream from peerID to its local
+// target
+func (c *Client) serveTunnel(stream io.ReadWriteCloser, req handshakeRequest, peerID string) {
+	if !c.checkTunnelTarget(stream, req, peerID) {
+		return
+	}
+
+	if !c.admitInbound(stream) {
+		return
+	}
+	defer c.inbound.release()
+
+	// Connect to local service
+	localConn, err := net.DialTimeout("tcp", req.Target, c.config.Timeout)
+	if err != nil {
+		rejectHandshake(stream, HandshakeTargetUnreachable, err.Error())
+		return
+	}
+	defer localConn.Close()
+
+	if err := writeHandshakeResponse(stream, HandshakeOK, ""); err != nil {
+		fmt.Printf("failed to acknowledge tunnel: %v\n", err)
+		return
+	}
+
+	// Bidirectional copy
+	limits := c.inbound.session(c.config.InboundIdleTimeout)
+	relay(context.Background(), localConn, stream, stream, localConn, limits)
+}
+
+// admitInbound takes an inbound session slot, waiting up to the timeout if
+// sessions are queued. The stream is rejected if no slot is free.
+func (c *Client) admitInbound(stream io.ReadWriteCloser) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+
+	if !c.inbound.acquire(ctx, true) {
+		rejectHandshake(stream, HandshakeBusy, fmt.Sprintf("%d tunnel sessions already active", c.config.InboundTunnelLimits.MaxSessions))
+		return false
+	}
+	return true
+}
+
+// isLocalHost reports whether host refers to the local machine
+func isLocalHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Connections returns all live connections opened with Connect
+func (c *Client) Connections() []Connection {
+	conns := c.conns.list()
+
+	result := make([]Connection, 0, len(conns))
+	for _, conn := range conns {
+		result = append(result, conn)
+	}
+	return result
 }
 
 // OnConnect registers a callback for connection events
@@ -330,26 +575,72 @@ func (c *Client) OnReconnect(callback func(peer string)) {
 	c.onReconnect = callback
 }
 
+// notifyConnect calls the connect callback, if one is registered
+func (c *Client) notifyConnect(peerID string) {
+	c.mu.RLock()
+	callback := c.onConnect
+	c.mu.RUnlock()
+
+	if callback != nil {
+		callback(peerID)
+	}
+}
+
+// notifyDisconnect calls the disconnect callback, if one is registered
+func (c *Client) notifyDisconnect(peerID string, err error) {
+	c.mu.RLock()
+	callback := c.onDisconnect
+	c.mu.RUnlock()
+
+	if callback != nil {
+		callback(peerID, err)
+	}
+}
+
+// notifyReconnect calls the reconnect callback, if one is registered
+func (c *Client) notifyReconnect(peerID string) {
+	c.mu.RLock()
+	callback := c.onReconnect
+	c.mu.RUnlock()
+
+	if callback != nil {
+		callback(peerID)
+	}
+}
+
 // Close closes the client and releases all resources
 func (c *Client) Close() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	if c.closed {
+		c.mu.Unlock()
 		return nil
 	}
 
 	c.closed = true
+	close(c.done)
+	for l := range c.listeners {
+		l.shutdown()
+	}
+	c.mu.Unlock()
 
-	if c.conn != nil {
-		if err := c.conn.close(); err != nil {
-			// Log error but continue closing transport
-			fmt.Printf("failed to close connection: %v\n", err)
-		}
+	// Closing connections and sessions fires the disconnect callback,
+	// which is read under c.mu
+	if err := c.conns.closeAll(); err != nil {
+		// Log error but continue closing transport
+		fmt.Printf("failed to close connections: %v\n", err)
 	}
 
+	if err := c.sessions.closeAll(); err != nil {
+		fmt.Printf("failed to close sessions: %v\n", err)
+	}
+
+	// Withdraw the local services before leaving the mesh
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	c.registry.close(ctx)
+	cancel()
+
 	if c.transport != nil {
-		if err := c.transport.close(); err != nil {
+		if err := c.transport.Close(); err != nil {
 			return fmt.Errorf("failed to close transport: %w", err)
 		}
 	}
@@ -362,4 +653,7 @@ type Health struct {
 	Status         string
 	Latency        time.Duration
 	ConnectedPeers int
+
+	// PeerConnections holds the number of live connections per peer ID
+	PeerConnections map[string]int
 }
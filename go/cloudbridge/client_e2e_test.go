@@ -0,0 +1,29 @@
+package cloudbridge_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+func TestConnectUnknownPeer(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+
+	_, err := alice.Connect(context.Background(), "nobody")
+	if err == nil {
+		t.Error("Connect() to unknown peer should fail")
+	}
+}
+
+func TestConnectPeerNotServing(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	newTestClient(t, network, "bob")
+
+	_, err := alice.Connect(context.Background(), "bob")
+	if err == nil {
+		t.Error("Connect() to peer without Serve() should fail")
+	}
+}
@@ -196,3 +196,57 @@ func TestClientCallbacks(t *testing.T) {
 	_ = disconnectCalled
 	_ = reconnectCalled
 }
+
+func TestClientConnectionRegistry(t *testing.T) {
+	client, _ := newPipeClient(t)
+	ctx := context.Background()
+
+	var conns []Connection
+	for _, peerID := range []string{"peer-a", "peer-a", "peer-b"} {
+		conn, err := client.Connect(ctx, peerID)
+		if err != nil {
+			t.Fatalf("Connect(%s) error = %v", peerID, err)
+		}
+		conns = append(conns, conn)
+	}
+
+	if conns[0].ID() == conns[1].ID() {
+		t.Errorf("connections to the same peer share ID %s", conns[0].ID())
+	}
+
+	if got := len(client.Connections()); got != 3 {
+		t.Errorf("Connections() returned %d connections, want 3", got)
+	}
+
+	health, err := client.Health(ctx)
+	if err != nil {
+		t.Fatalf("Health() error = %v", err)
+	}
+	if health.ConnectedPeers != 2 {
+		t.Errorf("Health().ConnectedPeers = %d, want 2", health.ConnectedPeers)
+	}
+	if health.PeerConnections["peer-a"] != 2 || health.PeerConnections["peer-b"] != 1 {
+		t.Errorf("Health().PeerConnections = %v, want peer-a:2 peer-b:1", health.PeerConnections)
+	}
+
+	// Closing one connection removes only that connection
+	if err := conns[0].Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := len(client.Connections()); got != 2 {
+		t.Errorf("Connections() after Close() returned %d connections, want 2", got)
+	}
+
+	// Closing the client closes every remaining connection
+	if err := client.Close(); err != nil {
+		t.Fatalf("Client.Close() error = %v", err)
+	}
+	if got := len(client.Connections()); got != 0 {
+		t.Errorf("Connections() after Client.Close() returned %d connections, want 0", got)
+	}
+	for _, conn := range conns {
+		if _, err := conn.Write([]byte("test")); err == nil {
+			t.Errorf("Write() on connection %s after Client.Close() should fail", conn.ID())
+		}
+	}
+}
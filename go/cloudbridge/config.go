@@ -2,6 +2,9 @@ package cloudbridge
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
 	"os"
 	"time"
 )
@@ -29,13 +32,34 @@ type Config struct {
 	// TLS configuration
 	InsecureSkipVerify bool
 
+	// Transport overrides the default relay transport
+	Transport Transport
+
+	// TunnelPolicy restricts the targets peers may reach through inbound
+	// tunnels (default: any port on the local machine)
+	TunnelPolicy *TunnelPolicy
+
+	// DenyTunnelsByDefault denies every inbound tunnel while no
+	// TunnelPolicy is set, instead of allowing local ports
+	DenyTunnelsByDefault bool
+
+	// InboundTunnelLimits caps the tunnels peers open to this client,
+	// across all of them (default: no limits)
+	InboundTunnelLimits TunnelLimits
+
+	// InboundIdleTimeout closes inbound tunnel connections that have seen
+	// no data in either direction for this long (default: none)
+	InboundIdleTimeout time.Duration
+
 	// Callbacks
 	OnConnect    func(peer string)
 	OnDisconnect func(peer string, err error)
 	OnReconnect  func(peer string)
 }
 
-// RetryPolicy defines retry behavior for failed operations
+// RetryPolicy defines retry behavior for failed operations.
+// Connections opened with Client.Connect use it to re-dial a failed stream;
+// MaxRetries of zero disables reconnection.
 type RetryPolicy struct {
 	MaxRetries   int
 	InitialDelay time.Duration
@@ -43,6 +67,19 @@ type RetryPolicy struct {
 	Multiplier   float64
 }
 
+// backoff returns the delay before retry attempt n (starting at 0).
+// The delay grows exponentially up to MaxDelay, with up to 50% random jitter
+// subtracted so that clients reconnecting after a relay restart spread out.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(attempt))
+	if delay > float64(p.MaxDelay) || math.IsInf(delay, 0) || math.IsNaN(delay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	jitter := rand.Float64() * delay / 2
+	return time.Duration(delay - jitter)
+}
+
 // Protocol represents a connection protocol
 type Protocol string
 
@@ -51,6 +88,7 @@ const (
 	ProtocolGRPC      Protocol = "grpc"
 	ProtocolWebSocket Protocol = "websocket"
 	ProtocolTCP       Protocol = "tcp"
+	ProtocolUDP       Protocol = "udp"
 )
 
 // Option is a functional option for configuring the client
@@ -105,6 +143,47 @@ func WithInsecureSkipVerify(skip bool) Option {
 	}
 }
 
+// WithTransport sets a custom transport instead of the CloudBridge relay.
+// The client takes ownership of the transport and closes it on Close.
+func WithTransport(transport Transport) Option {
+	return func(c *Config) {
+		c.Transport = transport
+	}
+}
+
+// WithTunnelPolicy restricts inbound tunnels to the targets allowed by
+// policy; everything else is denied
+func WithTunnelPolicy(policy TunnelPolicy) Option {
+	return func(c *Config) {
+		c.TunnelPolicy = &policy
+	}
+}
+
+// WithDenyTunnelsByDefault denies inbound tunnels unless a TunnelPolicy
+// allows them, so that a client without a policy is not an open proxy to
+// its local ports
+func WithDenyTunnelsByDefault() Option {
+	return func(c *Config) {
+		c.DenyTunnelsByDefault = true
+	}
+}
+
+// WithInboundTunnelLimits caps the bandwidth and concurrent sessions of
+// the tunnels peers open to this client
+func WithInboundTunnelLimits(limits TunnelLimits) Option {
+	return func(c *Config) {
+		c.InboundTunnelLimits = limits
+	}
+}
+
+// WithInboundIdleTimeout closes inbound tunnel connections after the
+// given time without data
+func WithInboundIdleTimeout(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.InboundIdleTimeout = timeout
+	}
+}
+
 // WithOnConnect sets the connection callback
 func WithOnConnect(callback func(peer string)) Option {
 	return func(c *Config) {
@@ -193,6 +272,20 @@ func (c *Config) validate() error {
 		return errors.New("invalid log level")
 	}
 
+	if c.TunnelPolicy != nil {
+		if err := c.TunnelPolicy.validate(); err != nil {
+			return fmt.Errorf("invalid tunnel policy: %w", err)
+		}
+	}
+
+	if err := c.InboundTunnelLimits.validate(); err != nil {
+		return fmt.Errorf("invalid inbound tunnel limits: %w", err)
+	}
+
+	if c.InboundIdleTimeout < 0 {
+		return errors.New("inbound idle timeout cannot be negative")
+	}
+
 	return nil
 }
 
@@ -3,20 +3,31 @@ package cloudbridge
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net"
+	"os"
 	"sync"
 	"time"
-
-	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/internal/bridge"
 )
 
-// Connection represents a P2P connection to a peer
+// Connection represents a P2P connection to a peer.
+// It satisfies net.Conn and can be used with HTTP, TLS and gRPC.
 type Connection interface {
 	io.ReadWriteCloser
 
+	// ID returns the connection identifier, unique within a Client
+	ID() string
+
 	// PeerID returns the peer identifier
 	PeerID() string
 
+	// LocalAddr returns the address of the local peer
+	LocalAddr() net.Addr
+
+	// RemoteAddr returns the address of the remote peer
+	RemoteAddr() net.Addr
+
 	// Metrics returns connection metrics
 	Metrics() (*ConnectionMetrics, error)
 
@@ -30,12 +41,29 @@ type Connection interface {
 	SetWriteDeadline(t time.Time) error
 }
 
+// PeerAddr is the net.Addr of a CloudBridge peer
+type PeerAddr struct {
+	PeerID string
+}
+
+// Network returns the address network name
+func (a PeerAddr) Network() string {
+	return "cloudbridge"
+}
+
+// String returns the peer ID
+func (a PeerAddr) String() string {
+	return a.PeerID
+}
+
 // connection implements the Connection interface
 type connection struct {
-	peerID string
-	client *Client
-	mu     sync.RWMutex
-	closed bool
+	id          string
+	peerID      string
+	localPeerID string
+	client      *Client
+	mu          sync.RWMutex
+	closed      bool
 
 	// Connection state
 	connected   bool
@@ -44,59 +72,202 @@ type connection struct {
 	// Metrics
 	bytesSent     uint64
 	bytesReceived uint64
-
-	// Underlying bridge connection
-	bridgeConn *bridge.PeerConnection
+	reconnects    int
+
+	// Underlying transport stream
+	bridgeConn Stream
+
+	// Reconnection state. redial is nil for connections that cannot be
+	// re-established (e.g. accepted streams). gen is bumped on every
+	// successful reconnect so concurrent readers and writers reconnect once.
+	redial        func(ctx context.Context) (Stream, error)
+	retry         RetryPolicy
+	ctx           context.Context
+	cancel        context.CancelFunc
+	reconnectMu   sync.Mutex
+	gen           uint64
+	readDeadline  time.Time
+	writeDeadline time.Time
 }
 
 // dial establishes a connection to the peer
 func (c *connection) dial(ctx context.Context) error {
-	// This method is deprecated in favor of transport.connectToPeer
-	return errors.New("use transport.connectToPeer instead")
+	// This method is deprecated in favor of Transport.ConnectToPeer
+	return errors.New("use Transport.ConnectToPeer instead")
 }
 
-// Read reads data from the connection
+// Read reads data from the connection.
+// If the underlying stream fails, Read transparently reconnects according to
+// the client's RetryPolicy and resumes on the new stream.
 func (c *connection) Read(b []byte) (int, error) {
-	c.mu.RLock()
-	if c.closed {
-		c.mu.RUnlock()
-		return 0, errors.New("connection is closed")
+	for {
+		stream, gen, err := c.current()
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := stream.Read(b)
+
+		c.mu.Lock()
+		c.bytesReceived += uint64(n)
+		c.mu.Unlock()
+
+		if err == nil || !c.shouldReconnect(err) {
+			return n, err
+		}
+		if n > 0 {
+			// Deliver what was read; the next Read will hit the failure again
+			return n, nil
+		}
+
+		if err := c.reconnect(gen, err); err != nil {
+			return 0, err
+		}
 	}
-	if c.bridgeConn == nil {
-		c.mu.RUnlock()
-		return 0, errors.New("connection not established")
+}
+
+// Write writes data to the connection.
+// Writes are delivered at most once: if the underlying stream fails, Write
+// reconnects according to the client's RetryPolicy but still returns the
+// error, and nothing of b is sent on the new stream. Bytes accepted by the
+// failed stream may not have reached the peer. The next Write uses the new
+// stream.
+func (c *connection) Write(b []byte) (int, error) {
+	stream, gen, err := c.current()
+	if err != nil {
+		return 0, err
 	}
-	c.mu.RUnlock()
 
-	n, err := c.bridgeConn.Read(b)
+	n, err := stream.Write(b)
 
 	c.mu.Lock()
-	c.bytesReceived += uint64(n)
+	c.bytesSent += uint64(n)
 	c.mu.Unlock()
 
+	if err == nil || !c.shouldReconnect(err) {
+		return n, err
+	}
+
+	if rerr := c.reconnect(gen, err); rerr != nil {
+		return n, rerr
+	}
 	return n, err
 }
 
-// Write writes data to the connection
-func (c *connection) Write(b []byte) (int, error) {
+// current returns the active stream and its generation
+func (c *connection) current() (Stream, uint64, error) {
 	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	if c.closed {
-		c.mu.RUnlock()
-		return 0, errors.New("connection is closed")
+		return nil, 0, errors.New("connection is closed")
 	}
 	if c.bridgeConn == nil {
-		c.mu.RUnlock()
-		return 0, errors.New("connection not established")
+		return nil, 0, errors.New("connection not established")
+	}
+	return c.bridgeConn, c.gen, nil
+}
+
+// shouldReconnect reports whether err indicates a broken stream worth re-dialing.
+// A clean EOF and deadline expiry are reported to the caller as-is.
+func (c *connection) shouldReconnect(err error) bool {
+	if c.redial == nil || c.retry.MaxRetries <= 0 {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.closed
+}
+
+// reconnect replaces the stream of generation gen after it failed with cause.
+// If another goroutine already replaced it, reconnect returns immediately.
+// When all retries fail the connection is closed.
+func (c *connection) reconnect(gen uint64, cause error) error {
+	c.reconnectMu.Lock()
+	defer c.reconnectMu.Unlock()
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return errors.New("connection is closed")
+	}
+	if c.gen != gen {
+		c.mu.Unlock()
+		return nil
+	}
+	old := c.bridgeConn
+	c.connected = false
+	c.mu.Unlock()
+
+	old.Close()
+
+	if c.client != nil {
+		c.client.notifyDisconnect(c.peerID, cause)
 	}
-	c.mu.RUnlock()
 
-	n, err := c.bridgeConn.Write(b)
+	stream, err := c.redialWithBackoff()
+	if err != nil {
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+
+		c.cancel()
+		if c.client != nil {
+			c.client.conns.remove(c)
+		}
+		return fmt.Errorf("failed to reconnect to peer %s: %w", c.peerID, err)
+	}
 
 	c.mu.Lock()
-	c.bytesSent += uint64(n)
+	if c.closed {
+		c.mu.Unlock()
+		stream.Close()
+		return errors.New("connection is closed")
+	}
+	if !c.readDeadline.IsZero() {
+		stream.SetReadDeadline(c.readDeadline)
+	}
+	if !c.writeDeadline.IsZero() {
+		stream.SetWriteDeadline(c.writeDeadline)
+	}
+	c.bridgeConn = stream
+	c.gen++
+	c.connected = true
+	c.reconnects++
 	c.mu.Unlock()
 
-	return n, err
+	if c.client != nil {
+		c.client.notifyReconnect(c.peerID)
+	}
+
+	return nil
+}
+
+// redialWithBackoff re-dials the peer until it succeeds, the retry budget is
+// exhausted or the connection is closed
+func (c *connection) redialWithBackoff() (Stream, error) {
+	var lastErr error
+	for attempt := 0; attempt < c.retry.MaxRetries; attempt++ {
+		timer := time.NewTimer(c.retry.backoff(attempt))
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return nil, errors.New("connection is closed")
+		case <-timer.C:
+		}
+
+		stream, err := c.redial(c.ctx)
+		if err == nil {
+			return stream, nil
+		}
+		lastErr = err
+	}
+
+	return nil, fmt.Errorf("giving up after %d attempts: %w", c.retry.MaxRetries, lastErr)
 }
 
 // Close closes the connection
@@ -104,30 +275,46 @@ func (c *connection) Close() error {
 	return c.close()
 }
 
-// close is the internal close method
+// close is the internal close method. The disconnect callback runs after
+// c.mu is released, so it may use the connection.
 func (c *connection) close() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	if c.closed {
+		c.mu.Unlock()
 		return nil
 	}
 
+	// A connection that is reconnecting has already reported its disconnect
+	wasConnected := c.connected
+
 	c.closed = true
 	c.connected = false
 
+	if c.cancel != nil {
+		c.cancel()
+	}
+
 	var err error
 	if c.bridgeConn != nil {
 		err = c.bridgeConn.Close()
 	}
+	c.mu.Unlock()
 
-	if c.client != nil && c.client.onDisconnect != nil {
-		c.client.onDisconnect(c.peerID, err)
+	if c.client != nil {
+		c.client.conns.remove(c)
+		if wasConnected {
+			c.client.notifyDisconnect(c.peerID, err)
+		}
 	}
 
 	return err
 }
 
+// ID returns the connection identifier
+func (c *connection) ID() string {
+	return c.id
+}
+
 // PeerID returns the peer identifier
 func (c *connection) PeerID() string {
 	return c.peerID
@@ -148,25 +335,162 @@ func (c *connection) Metrics() (*ConnectionMetrics, error) {
 		RTT:           10 * time.Millisecond, // TODO: Get actual RTT
 		Connected:     c.connected,
 		ConnectedAt:   c.connectedAt,
+		Reconnects:    c.reconnects,
 	}, nil
 }
 
-// SetDeadline sets the read and write deadlines
+// LocalAddr returns the address of the local peer
+func (c *connection) LocalAddr() net.Addr {
+	return PeerAddr{PeerID: c.localPeerID}
+}
+
+// RemoteAddr returns the address of the remote peer
+func (c *connection) RemoteAddr() net.Addr {
+	return PeerAddr{PeerID: c.peerID}
+}
+
+// SetDeadline sets the read and write deadlines.
+// Reads and writes past the deadline fail with an error wrapping os.ErrDeadlineExceeded.
+// Deadlines are carried over to the new stream after a reconnect.
 func (c *connection) SetDeadline(t time.Time) error {
-	// TODO: Implement deadline setting
-	return errors.New("not implemented")
+	stream, err := c.stream()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	c.mu.Unlock()
+
+	return stream.SetDeadline(t)
 }
 
 // SetReadDeadline sets the read deadline
 func (c *connection) SetReadDeadline(t time.Time) error {
-	// TODO: Implement read deadline setting
-	return errors.New("not implemented")
+	stream, err := c.stream()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+
+	return stream.SetReadDeadline(t)
 }
 
 // SetWriteDeadline sets the write deadline
 func (c *connection) SetWriteDeadline(t time.Time) error {
-	// TODO: Implement write deadline setting
-	return errors.New("not implemented")
+	stream, err := c.stream()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+
+	return stream.SetWriteDeadline(t)
+}
+
+// stream returns the underlying stream if the connection is usable
+func (c *connection) stream() (Stream, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return nil, errors.New("connection is closed")
+	}
+	if c.bridgeConn == nil {
+		return nil, errors.New("connection not established")
+	}
+	return c.bridgeConn, nil
+}
+
+var _ net.Conn = (*connection)(nil)
+
+// connRegistry tracks live connections by peer ID and connection ID
+type connRegistry struct {
+	mu     sync.RWMutex
+	peers  map[string]map[string]*connection
+	nextID uint64
+}
+
+// newConnRegistry creates an empty connection registry
+func newConnRegistry() *connRegistry {
+	return &connRegistry{
+		peers: make(map[string]map[string]*connection),
+	}
+}
+
+// add assigns the connection an ID and registers it
+func (r *connRegistry) add(conn *connection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	conn.id = fmt.Sprintf("%s-%d", conn.peerID, r.nextID)
+
+	byID, ok := r.peers[conn.peerID]
+	if !ok {
+		byID = make(map[string]*connection)
+		r.peers[conn.peerID] = byID
+	}
+	byID[conn.id] = conn
+}
+
+// remove unregisters the connection
+func (r *connRegistry) remove(conn *connection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byID, ok := r.peers[conn.peerID]
+	if !ok {
+		return
+	}
+
+	delete(byID, conn.id)
+	if len(byID) == 0 {
+		delete(r.peers, conn.peerID)
+	}
+}
+
+// list returns all live connections
+func (r *connRegistry) list() []*connection {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var conns []*connection
+	for _, byID := range r.peers {
+		for _, conn := range byID {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+// peerCounts returns the number of live connections per peer
+func (r *connRegistry) peerCounts() map[string]int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := make(map[string]int, len(r.peers))
+	for peerID, byID := range r.peers {
+		counts[peerID] = len(byID)
+	}
+	return counts
+}
+
+// closeAll closes every registered connection
+func (r *connRegistry) closeAll() error {
+	var errs []error
+	for _, conn := range r.list() {
+		if err := conn.close(); err != nil {
+			errs = append(errs, fmt.Errorf("connection %s: %w", conn.id, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // ConnectionMetrics represents metrics for a connection
@@ -176,4 +500,5 @@ type ConnectionMetrics struct {
 	RTT           time.Duration
 	Connected     bool
 	ConnectedAt   time.Time
+	Reconnects    int
 }
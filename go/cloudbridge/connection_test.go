@@ -1,8 +1,12 @@
 package cloudbridge
 
 import (
+	"context"
 	"errors"
 	"io"
+	"net"
+	"os"
+	"sync"
 	"testing"
 	"time"
 )
@@ -245,7 +249,19 @@ func TestConnectionSetDeadline(t *testing.T) {
 
 	err := conn.SetDeadline(time.Now().Add(time.Second))
 	if err == nil {
-		t.Error("SetDeadline() should return error (not implemented)")
+		t.Error("SetDeadline() should return error without a stream")
+	}
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	conn.bridgeConn = local
+
+	if err := conn.SetDeadline(time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("SetDeadline() error = %v", err)
+	}
+
+	if _, err := conn.Write([]byte("test")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Write() after deadline error = %v, want os.ErrDeadlineExceeded", err)
 	}
 }
 
@@ -256,18 +272,56 @@ func TestConnectionSetReadDeadline(t *testing.T) {
 
 	err := conn.SetReadDeadline(time.Now().Add(time.Second))
 	if err == nil {
-		t.Error("SetReadDeadline() should return error (not implemented)")
+		t.Error("SetReadDeadline() should return error without a stream")
+	}
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	conn.bridgeConn = local
+
+	if err := conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatalf("SetReadDeadline() error = %v", err)
+	}
+
+	_, err = conn.Read(make([]byte, 16))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read() error = %v, want os.ErrDeadlineExceeded", err)
+	}
+
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Read() error = %v, want net.Error with Timeout()", err)
 	}
 }
 
 func TestConnectionSetWriteDeadline(t *testing.T) {
 	conn := &connection{
 		peerID: "peer-123",
+		closed: true,
 	}
 
 	err := conn.SetWriteDeadline(time.Now().Add(time.Second))
 	if err == nil {
-		t.Error("SetWriteDeadline() should return error (not implemented)")
+		t.Error("SetWriteDeadline() should return error for closed connection")
+	}
+}
+
+func TestConnectionAddr(t *testing.T) {
+	var conn net.Conn = &connection{
+		peerID:      "peer-123",
+		localPeerID: "peer-local",
+	}
+
+	if conn.RemoteAddr().String() != "peer-123" {
+		t.Errorf("RemoteAddr() = %v, want %v", conn.RemoteAddr(), "peer-123")
+	}
+
+	if conn.LocalAddr().String() != "peer-local" {
+		t.Errorf("LocalAddr() = %v, want %v", conn.LocalAddr(), "peer-local")
+	}
+
+	if conn.RemoteAddr().Network() != "cloudbridge" {
+		t.Errorf("RemoteAddr().Network() = %v, want %v", conn.RemoteAddr().Network(), "cloudbridge")
 	}
 }
 
@@ -297,3 +351,235 @@ func TestConnectionBytesTracking(t *testing.T) {
 	}
 }
 
+
+// fastRetry is a retry policy suitable for tests
+var fastRetry = RetryPolicy{
+	MaxRetries:   3,
+	InitialDelay: time.Millisecond,
+	MaxDelay:     5 * time.Millisecond,
+	Multiplier:   2.0,
+}
+
+func TestConnectionReconnect(t *testing.T) {
+	var mu sync.Mutex
+	var disconnects, reconnects int
+
+	client, tr := newPipeClient(t,
+		WithRetryPolicy(fastRetry),
+		WithOnDisconnect(func(peer string, err error) {
+			mu.Lock()
+			disconnects++
+			mu.Unlock()
+		}),
+		WithOnReconnect(func(peer string) {
+			mu.Lock()
+			reconnects++
+			mu.Unlock()
+		}),
+	)
+
+	conn, err := client.Connect(context.Background(), "peer-123")
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer conn.Close()
+
+	// Break the first stream. The write that hits the failure reports it;
+	// the next one must land on a new stream.
+	tr.remote(t, 0).Close()
+
+	if _, err := conn.Write([]byte("lost")); err == nil {
+		t.Error("Write() on broken stream error = nil, want error")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Write([]byte("hello"))
+		done <- err
+	}()
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(tr.remote(t, 1), buf); err != nil {
+		t.Fatalf("ReadFull() on new stream error = %v", err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("received %q, want %q", buf, "hello")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Write() error = %v", err)
+	}
+
+	mu.Lock()
+	if disconnects != 1 || reconnects != 1 {
+		t.Errorf("callbacks: disconnects = %d, reconnects = %d, want 1 and 1", disconnects, reconnects)
+	}
+	mu.Unlock()
+
+	metrics, err := conn.Metrics()
+	if err != nil {
+		t.Fatalf("Metrics() error = %v", err)
+	}
+	if metrics.Reconnects != 1 || !metrics.Connected {
+		t.Errorf("Metrics() = %+v, want 1 reconnect and connected", metrics)
+	}
+}
+
+func TestConnectionReconnectMidWrite(t *testing.T) {
+	client, tr := newPipeClient(t, WithRetryPolicy(fastRetry))
+
+	conn, err := client.Connect(context.Background(), "peer-123")
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer conn.Close()
+
+	// The first stream breaks after taking part of the write
+	go func() {
+		remote := tr.remote(t, 0)
+		io.ReadFull(remote, make([]byte, 3))
+		remote.Close()
+	}()
+
+	n, err := conn.Write([]byte("frame-1"))
+	if err == nil || n != 3 {
+		t.Fatalf("Write() = %d, %v, want 3 and an error", n, err)
+	}
+
+	// The rest of the interrupted write must not reach the new stream
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Write([]byte("frame-2"))
+		done <- err
+	}()
+
+	buf := make([]byte, 7)
+	if _, err := io.ReadFull(tr.remote(t, 1), buf); err != nil {
+		t.Fatalf("ReadFull() on new stream error = %v", err)
+	}
+	if string(buf) != "frame-2" {
+		t.Errorf("new stream received %q, want %q", buf, "frame-2")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Write() after reconnect error = %v", err)
+	}
+}
+
+func TestConnectionReconnectGivesUp(t *testing.T) {
+	client, tr := newPipeClient(t, WithRetryPolicy(fastRetry))
+
+	conn, err := client.Connect(context.Background(), "peer-123")
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	tr.setRefuse(true)
+	tr.remote(t, 0).Close()
+
+	if _, err := conn.Write([]byte("hello")); err == nil {
+		t.Fatal("Write() should fail when the peer cannot be re-dialed")
+	}
+
+	if _, err := conn.Write([]byte("hello")); err == nil || err.Error() != "connection is closed" {
+		t.Errorf("Write() after giving up error = %v, want connection is closed", err)
+	}
+
+	if got := len(client.Connections()); got != 0 {
+		t.Errorf("Connections() after giving up returned %d connections, want 0", got)
+	}
+}
+
+func TestConnectionNoReconnectOnEOF(t *testing.T) {
+	client, tr := newPipeClient(t, WithRetryPolicy(fastRetry))
+
+	conn, err := client.Connect(context.Background(), "peer-123")
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer conn.Close()
+
+	tr.remote(t, 0).Close()
+
+	if _, err := conn.Read(make([]byte, 16)); err != io.EOF {
+		t.Errorf("Read() error = %v, want io.EOF", err)
+	}
+
+	tr.mu.Lock()
+	opened := len(tr.accepted)
+	tr.mu.Unlock()
+	if opened != 1 {
+		t.Errorf("EOF triggered reconnection: %d streams opened, want 1", opened)
+	}
+}
+
+func TestConnectionReconnectCallbacksRace(t *testing.T) {
+	client, tr := newPipeClient(t, WithRetryPolicy(fastRetry))
+
+	conn, err := client.Connect(context.Background(), "peer-123")
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer conn.Close()
+
+	// Callbacks may be replaced while the connection reconnects
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				client.OnDisconnect(func(peer string, err error) {})
+				client.OnReconnect(func(peer string) {})
+			}
+		}
+	}()
+
+	tr.remote(t, 0).Close()
+	go func() {
+		io.Copy(io.Discard, tr.remote(t, 1))
+	}()
+
+	// The interrupted write fails; the connection is then re-dialed
+	if _, err := conn.Write([]byte("hello")); err == nil {
+		t.Error("Write() on broken stream error = nil, want error")
+	}
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Errorf("Write() after reconnect error = %v", err)
+	}
+
+	close(stop)
+	<-done
+}
+
+func TestConnectionCloseCallbackUsesConnection(t *testing.T) {
+	client, _ := newPipeClient(t)
+
+	conn, err := client.Connect(context.Background(), "peer-123")
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	// The callback runs after the connection is unlocked
+	called := make(chan struct{})
+	client.OnDisconnect(func(peer string, err error) {
+		conn.Metrics()
+		conn.SetDeadline(time.Now())
+		conn.Close()
+		close(called)
+	})
+
+	closed := make(chan struct{})
+	go func() {
+		conn.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() deadlocked in the disconnect callback")
+	}
+	<-called
+}
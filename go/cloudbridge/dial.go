@@ -0,0 +1,196 @@
+package cloudbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// peerDomain is the pseudo top-level domain for peer addresses
+const peerDomain = ".cb"
+
+// DialContext connects to a TCP service on a remote peer, using the tunnel
+// handshake to reach it. addr is a host:port pair whose host is either
+//
+//	<peer-id>.cb            the port on the peer's loopback interface
+//	<service>.<peer-id>.cb  a service registered by the peer; the port in
+//	                        addr is ignored in favour of the service port
+//
+// Unlike Connect, the returned connection does not reconnect on failure,
+// since the remote service would see a new connection mid-stream.
+func (c *Client) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return nil, errors.New("client is closed")
+	}
+	c.mu.RUnlock()
+
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", network)
+	}
+
+	peerID, port, err := c.resolve(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.dialTarget(ctx, peerID, net.JoinHostPort("localhost", strconv.Itoa(port)))
+}
+
+// dialTarget connects to target through peerID using the tunnel handshake.
+// The connection does not reconnect.
+func (c *Client) dialTarget(ctx context.Context, peerID, target string) (net.Conn, error) {
+	return c.connect(ctx, peerID, RetryPolicy{}, func(ctx context.Context) (Stream, error) {
+		return c.openHandshakeStream(ctx, peerID, StreamKindTunnel, target)
+	})
+}
+
+// resolve maps a peer address to a peer ID and port
+func (c *Client) resolve(ctx context.Context, addr string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+
+	cut := len(host) - len(peerDomain)
+	if cut <= 0 || !strings.EqualFold(host[cut:], peerDomain) {
+		return "", 0, fmt.Errorf("%s is not a CloudBridge address (want <peer-id>%s)", host, peerDomain)
+	}
+	name := host[:cut]
+
+	// <service>.<peer-id>.cb
+	if service, peerID, ok := strings.Cut(name, "."); ok {
+		services, err := c.DiscoverServices(ctx, service)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+		for _, s := range services {
+			if strings.EqualFold(s.PeerID, peerID) {
+				return s.PeerID, s.Port, nil
+			}
+		}
+		// Fall through: peer IDs may themselves contain dots
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in address %q", addr)
+	}
+
+	return name, port, nil
+}
+
+// DialServiceOption configures DialService
+type DialServiceOption func(*dialServiceConfig)
+
+// dialServiceConfig holds the options of one DialService call
+type dialServiceConfig struct {
+	balancer Balancer
+	key      string
+}
+
+// WithBalancer sets the balancer that chooses the instance. Balancers keep
+// state such as connection counts, so reuse one across calls.
+func WithBalancer(b Balancer) DialServiceOption {
+	return func(c *dialServiceConfig) {
+		c.balancer = b
+	}
+}
+
+// WithHashKey sets the key for NewConsistentHashBalancer, e.g. a user ID
+func WithHashKey(key string) DialServiceOption {
+	return func(c *dialServiceConfig) {
+		c.key = key
+	}
+}
+
+// DialService connects to a healthy instance of the service named name,
+// chosen by the balancer (default: round robin). If the connection fails,
+// the next instance the balancer picked is tried. Local instances are
+// dialed directly.
+func (c *Client) DialService(ctx context.Context, name string, opts ...DialServiceOption) (net.Conn, error) {
+	var config dialServiceConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.balancer == nil {
+		config.balancer = c.balancer
+	}
+
+	instances, err := c.DiscoverServices(ctx, name, WithHealthyOnly())
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no healthy instances of service %s", name)
+	}
+
+	observer, _ := config.balancer.(DialObserver)
+
+	var errs []error
+	for _, instance := range config.balancer.Pick(instances, config.key) {
+		start := time.Now()
+		conn, err := c.dialInstance(ctx, instance)
+		if observer != nil {
+			observer.ObserveDial(instance, time.Since(start), err)
+		}
+		if err == nil {
+			if observer == nil {
+				return conn, nil
+			}
+			return &serviceConn{Conn: conn, close: func() { observer.ObserveClose(instance) }}, nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s on %s: %w", instance.ID, instance.PeerID, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("failed to dial service %s: %w", name, errors.Join(errs...))
+}
+
+// dialInstance connects to one service instance
+func (c *Client) dialInstance(ctx context.Context, instance Service) (net.Conn, error) {
+	target := net.JoinHostPort("localhost", strconv.Itoa(instance.Port))
+	if instance.PeerID == c.transport.LocalPeerID() {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", target)
+	}
+	return c.dialTarget(ctx, instance.PeerID, target)
+}
+
+// serviceConn reports its close to the balancer that chose it
+type serviceConn struct {
+	net.Conn
+	once  sync.Once
+	close func()
+}
+
+// Close closes the connection and reports it once
+func (sc *serviceConn) Close() error {
+	sc.once.Do(sc.close)
+	return sc.Conn.Close()
+}
+
+// HTTPTransport returns an http.Transport that sends requests to peers
+// through DialContext, e.g. http://peer-123.cb/path. Idle connections are
+// pooled per peer address and reused across requests.
+func (c *Client) HTTPTransport() *http.Transport {
+	return &http.Transport{
+		DialContext:           c.DialContext,
+		MaxIdleConnsPerHost:   8,
+		IdleConnTimeout:       90 * time.Second,
+		ResponseHeaderTimeout: c.config.Timeout,
+		ExpectContinueTimeout: time.Second,
+	}
+}
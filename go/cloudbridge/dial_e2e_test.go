@@ -0,0 +1,141 @@
+package cloudbridge_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+func TestHTTPTransport(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+	serve(t, network, bob, "bob")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start HTTP server: %v", err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "path %s", r.URL.Path)
+		}),
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	transport := alice.HTTPTransport()
+	defer transport.CloseIdleConnections()
+	httpClient := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+
+	for i := 0; i < 3; i++ {
+		resp, err := httpClient.Get(fmt.Sprintf("http://bob.cb:%d/status", port))
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("ReadAll() error = %v", err)
+		}
+		if string(body) != "path /status" {
+			t.Errorf("body = %q, want %q", body, "path /status")
+		}
+	}
+
+	// Sequential requests reuse one pooled connection to the peer
+	if conns := alice.Connections(); len(conns) != 1 {
+		t.Errorf("Connections() = %d, want 1 pooled connection", len(conns))
+	}
+}
+
+// startNamedServer starts a TCP server that greets each connection with name
+func startNamedServer(t *testing.T, name string) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(name))
+			conn.Close()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestDialService(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	ctx := context.Background()
+
+	for _, peer := range []string{"bob", "carol"} {
+		client := newTestClient(t, network, peer)
+		serve(t, network, client, peer)
+		port := startNamedServer(t, peer)
+		if err := client.RegisterService(ctx, cloudbridge.ServiceConfig{Name: "api", Port: port}); err != nil {
+			t.Fatalf("RegisterService() error = %v", err)
+		}
+	}
+
+	// dave's instance refuses connections, so dials move on to the next one
+	dave := newTestClient(t, network, "dave")
+	serve(t, network, dave, "dave")
+	if err := dave.RegisterService(ctx, cloudbridge.ServiceConfig{Name: "api", Port: freePort(t)}); err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+
+	waitFor(t, "alice to discover all instances", func() bool {
+		return len(discoverPeers(t, alice, "api")) == 3
+	})
+
+	counts := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		conn, err := alice.DialService(ctx, "api")
+		if err != nil {
+			t.Fatalf("DialService() error = %v", err)
+		}
+		data, _ := io.ReadAll(conn)
+		conn.Close()
+		counts[string(data)]++
+	}
+	// Round robin over bob, carol and dave; dave's turns fail over to bob
+	if counts["bob"] != 4 || counts["carol"] != 2 {
+		t.Errorf("DialService() reached %v, want bob 4 and carol 2 times", counts)
+	}
+
+	// The same key keeps reaching the same instance
+	b := cloudbridge.NewConsistentHashBalancer()
+	var first string
+	for i := 0; i < 3; i++ {
+		conn, err := alice.DialService(ctx, "api", cloudbridge.WithBalancer(b), cloudbridge.WithHashKey("user-42"))
+		if err != nil {
+			t.Fatalf("DialService() error = %v", err)
+		}
+		data, _ := io.ReadAll(conn)
+		conn.Close()
+		if first == "" {
+			first = string(data)
+		} else if string(data) != first {
+			t.Errorf("DialService() with hash key reached %s, then %s", first, data)
+		}
+	}
+}
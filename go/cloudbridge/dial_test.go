@@ -0,0 +1,52 @@
+package cloudbridge
+
+import (
+	"context"
+	"testing"
+)
+
+func TestClientResolve(t *testing.T) {
+	client, _ := newPipeClient(t)
+
+	ctx := context.Background()
+	if err := client.RegisterService(ctx, ServiceConfig{Name: "web", Port: 8080}); err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		addr     string
+		wantPeer string
+		wantPort int
+		wantErr  bool
+	}{
+		{"peer address", "peer-123.cb:80", "peer-123", 80, false},
+		{"upper-case domain", "peer-123.CB:443", "peer-123", 443, false},
+		{"service address", "web.local-peer.cb:80", "local-peer", 8080, false},
+		{"unknown service falls back to peer ID", "db.local-peer.cb:5432", "db.local-peer", 5432, false},
+		{"not a peer address", "example.com:80", "", 0, true},
+		{"bare domain", ".cb:80", "", 0, true},
+		{"missing port", "peer-123.cb", "", 0, true},
+		{"invalid port", "peer-123.cb:http", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer, port, err := client.resolve(ctx, tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if peer != tt.wantPeer || port != tt.wantPort {
+				t.Errorf("resolve() = %v, %v, want %v, %v", peer, port, tt.wantPeer, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestClientDialContextNetwork(t *testing.T) {
+	client, _ := newPipeClient(t)
+
+	if _, err := client.DialContext(context.Background(), "udp", "peer-123.cb:53"); err == nil {
+		t.Error("DialContext() with udp network should fail")
+	}
+}
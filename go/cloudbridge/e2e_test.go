@@ -0,0 +1,138 @@
+// End-to-end tests run clients against each other on an in-memory network.
+// This file holds the helpers they share.
+package cloudbridge_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+// testTransport is a memtransport.Transport that reports when Serve has
+// installed its stream handler
+type testTransport struct {
+	*memtransport.Transport
+	once    sync.Once
+	serving chan struct{}
+}
+
+// testTransportKey identifies a peer on a network
+type testTransportKey struct {
+	network *memtransport.Network
+	peerID  string
+}
+
+// testTransports holds every transport created by newTestTransport
+var testTransports sync.Map
+
+// newTestTransport creates a transport for peerID attached to the network
+func newTestTransport(network *memtransport.Network, peerID string) *testTransport {
+	transport := &testTransport{
+		Transport: network.NewTransport(peerID),
+		serving:   make(chan struct{}),
+	}
+	testTransports.Store(testTransportKey{network, peerID}, transport)
+
+	return transport
+}
+
+// SetStreamHandler sets the handler for incoming streams and signals serve
+func (t *testTransport) SetStreamHandler(handler cloudbridge.StreamHandler) {
+	t.Transport.SetStreamHandler(handler)
+	t.once.Do(func() { close(t.serving) })
+}
+
+// newTestClient creates a client attached to the network
+func newTestClient(t *testing.T, network *memtransport.Network, peerID string) *cloudbridge.Client {
+	t.Helper()
+
+	client, err := cloudbridge.NewClient(
+		cloudbridge.WithToken("test-token"),
+		cloudbridge.WithTransport(newTestTransport(network, peerID)),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client %s: %v", peerID, err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+// serve runs client.Serve until the test ends and waits for the stream
+// handler. The client's transport must come from newTestTransport.
+func serve(t *testing.T, network *memtransport.Network, client *cloudbridge.Client, peerID string) {
+	t.Helper()
+
+	transport, ok := testTransports.Load(testTransportKey{network, peerID})
+	if !ok {
+		t.Fatalf("transport for %s was not created with newTestTransport", peerID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go client.Serve(ctx)
+
+	select {
+	case <-transport.(*testTransport).serving:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Serve() did not install a stream handler for %s", peerID)
+	}
+}
+
+// startEchoServer starts a TCP echo server on a loopback port
+func startEchoServer(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start echo server: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// freePort returns a currently unused TCP port
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
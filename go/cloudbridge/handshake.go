@@ -0,0 +1,359 @@
+package cloudbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Every incoming stream starts with a handshake request from the dialer,
+// answered by a handshake response before any payload is exchanged. Both are
+// sent as a single message frame (see message.go) with a binary payload
+// (integers big-endian, strings prefixed by a uint16 length):
+//
+//	request:  magic "CBHS" | version (1) | kind (1) | target | metadata | options
+//	response: magic "CBHS" | version (1) | code (1) | message
+//
+// metadata and options are a uint16 count followed by key/value string pairs.
+//
+// The metadata holds the peer ID and tenant the dialer declares for itself.
+// They are claims, not credentials: no token or proof is sent, so no access
+// decision is based on them. The peer ID claim is checked against the peer
+// the transport authenticated, and reported only when the transport does not
+// identify the peer; the tenant claim is informational.
+const (
+	handshakeMagic   = "CBHS"
+	handshakeVersion = 1
+
+	// Metadata keys, holding unverified claims
+	metaPeerID   = "peer"
+	metaTenantID = "tenant"
+
+	// Option keys
+	optIdleTimeout = "idle-timeout"
+	optApplication = "application"
+)
+
+// StreamKind identifies what an incoming stream is used for
+type StreamKind uint8
+
+// Stream kinds
+const (
+	StreamKindTunnel   StreamKind = 1
+	StreamKindSession  StreamKind = 2
+	StreamKindProtocol StreamKind = 3
+	StreamKindUDP      StreamKind = 4
+	StreamKindReverse  StreamKind = 5
+	StreamKindStream   StreamKind = 6
+)
+
+// String returns the stream kind name
+func (k StreamKind) String() string {
+	switch k {
+	case StreamKindTunnel:
+		return "tunnel"
+	case StreamKindSession:
+		return "session"
+	case StreamKindProtocol:
+		return "protocol"
+	case StreamKindUDP:
+		return "udp"
+	case StreamKindReverse:
+		return "reverse"
+	case StreamKindStream:
+		return "stream"
+	default:
+		return fmt.Sprintf("kind(%d)", uint8(k))
+	}
+}
+
+// HandshakeCode is the result of a handshake reported by the accepting peer
+type HandshakeCode uint8
+
+// Handshake result codes
+const (
+	HandshakeOK HandshakeCode = iota
+	HandshakeBadRequest
+	HandshakeUnsupportedVersion
+	HandshakeUnsupportedKind
+	HandshakeUnauthorized
+	HandshakeForbidden
+	HandshakeTargetUnreachable
+	HandshakeInternalError
+	HandshakeUnknownProtocol
+	HandshakeBusy
+)
+
+// String returns the handshake code name
+func (c HandshakeCode) String() string {
+	switch c {
+	case HandshakeOK:
+		return "ok"
+	case HandshakeBadRequest:
+		return "bad request"
+	case HandshakeUnsupportedVersion:
+		return "unsupported version"
+	case HandshakeUnsupportedKind:
+		return "unsupported stream kind"
+	case HandshakeUnauthorized:
+		return "unauthorized"
+	case HandshakeForbidden:
+		return "forbidden"
+	case HandshakeTargetUnreachable:
+		return "target unreachable"
+	case HandshakeInternalError:
+		return "internal error"
+	case HandshakeUnknownProtocol:
+		return "unknown protocol"
+	case HandshakeBusy:
+		return "busy"
+	default:
+		return fmt.Sprintf("code(%d)", uint8(c))
+	}
+}
+
+// HandshakeError is returned when a peer rejects a stream handshake
+type HandshakeError struct {
+	Code    HandshakeCode
+	Message string
+}
+
+func (e *HandshakeError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("handshake rejected: %s: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("handshake rejected: %s", e.Code)
+}
+
+// handshakeRequest is sent by the dialer of a stream
+type handshakeRequest struct {
+	Kind     StreamKind
+	Target   string
+	Metadata map[string]string
+	Options  map[string]string
+}
+
+// handshake performs the dialer side of a handshake on stream.
+// The stream deadline follows ctx until the response has been read.
+func handshake(ctx context.Context, stream Stream, req handshakeRequest) error {
+	return withDeadline(ctx, stream.SetDeadline, func() error {
+		if err := writeHandshake(stream, req); err != nil {
+			return fmt.Errorf("failed to send handshake: %w", err)
+		}
+		return readHandshakeResponse(stream)
+	})
+}
+
+// writeHandshake sends a handshake request
+func writeHandshake(w io.Writer, req handshakeRequest) error {
+	var buf bytes.Buffer
+	buf.WriteString(handshakeMagic)
+	buf.WriteByte(handshakeVersion)
+	buf.WriteByte(byte(req.Kind))
+	if err := putString(&buf, req.Target); err != nil {
+		return err
+	}
+	if err := putMap(&buf, req.Metadata); err != nil {
+		return err
+	}
+	if err := putMap(&buf, req.Options); err != nil {
+		return err
+	}
+
+	_, err := writeFrame(w, buf.Bytes())
+	return err
+}
+
+// readHandshake reads a handshake request.
+// Malformed requests yield a *HandshakeError to send back to the dialer.
+func readHandshake(r io.Reader) (handshakeRequest, error) {
+	var req handshakeRequest
+
+	payload, _, err := readFrame(r, maxHandshakeSize)
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedFrame) || errors.Is(err, ErrMessageTooLarge) {
+			return req, &HandshakeError{Code: HandshakeBadRequest, Message: err.Error()}
+		}
+		return req, err
+	}
+
+	br := bytes.NewReader(payload)
+	if err := readPreamble(br); err != nil {
+		return req, err
+	}
+
+	kind, err := br.ReadByte()
+	if err != nil {
+		return req, malformedHandshake(err)
+	}
+	req.Kind = StreamKind(kind)
+
+	if req.Target, err = getString(br); err != nil {
+		return req, malformedHandshake(err)
+	}
+	if req.Metadata, err = getMap(br); err != nil {
+		return req, malformedHandshake(err)
+	}
+	if req.Options, err = getMap(br); err != nil {
+		return req, malformedHandshake(err)
+	}
+
+	return req, nil
+}
+
+// writeHandshakeResponse answers a handshake request
+func writeHandshakeResponse(w io.Writer, code HandshakeCode, message string) error {
+	var buf bytes.Buffer
+	buf.WriteString(handshakeMagic)
+	buf.WriteByte(handshakeVersion)
+	buf.WriteByte(byte(code))
+	if len(message) > 1024 {
+		message = message[:1024]
+	}
+	putString(&buf, message)
+
+	_, err := writeFrame(w, buf.Bytes())
+	return err
+}
+
+// readHandshakeResponse reads a handshake response and returns a
+// *HandshakeError if the peer rejected the stream
+func readHandshakeResponse(r io.Reader) error {
+	payload, _, err := readFrame(r, maxHandshakeSize)
+	if err != nil {
+		return fmt.Errorf("failed to read handshake response: %w", err)
+	}
+
+	br := bytes.NewReader(payload)
+	if err := readPreamble(br); err != nil {
+		return fmt.Errorf("invalid handshake response: %w", err)
+	}
+
+	code, err := br.ReadByte()
+	if err != nil {
+		return fmt.Errorf("invalid handshake response: %w", err)
+	}
+	message, err := getString(br)
+	if err != nil {
+		return fmt.Errorf("invalid handshake response: %w", err)
+	}
+
+	if HandshakeCode(code) != HandshakeOK {
+		return &HandshakeError{Code: HandshakeCode(code), Message: message}
+	}
+	return nil
+}
+
+// rejectHandshake logs a refused stream and reports the reason to the dialer
+func rejectHandshake(w io.Writer, code HandshakeCode, message string) {
+	fmt.Printf("rejected incoming stream: %s: %s\n", code, message)
+	writeHandshakeResponse(w, code, message)
+}
+
+// setHandshakeDeadline bounds the time an incoming stream may take to send
+// its handshake, if the stream supports deadlines
+func setHandshakeDeadline(stream io.ReadWriteCloser, timeout time.Duration) func() {
+	d, ok := stream.(interface{ SetReadDeadline(time.Time) error })
+	if !ok || timeout <= 0 {
+		return func() {}
+	}
+	d.SetReadDeadline(time.Now().Add(timeout))
+	return func() { d.SetReadDeadline(time.Time{}) }
+}
+
+// readPreamble checks the magic and version of a handshake payload
+func readPreamble(br *bytes.Reader) error {
+	preamble := make([]byte, len(handshakeMagic)+1)
+	if _, err := io.ReadFull(br, preamble); err != nil {
+		return malformedHandshake(err)
+	}
+	if string(preamble[:len(handshakeMagic)]) != handshakeMagic {
+		return &HandshakeError{Code: HandshakeBadRequest, Message: "not a cloudbridge handshake"}
+	}
+	if version := preamble[len(handshakeMagic)]; version != handshakeVersion {
+		return &HandshakeError{
+			Code:    HandshakeUnsupportedVersion,
+			Message: fmt.Sprintf("version %d, supported %d", version, handshakeVersion),
+		}
+	}
+	return nil
+}
+
+// malformedHandshake wraps a decoding error
+func malformedHandshake(err error) error {
+	return &HandshakeError{Code: HandshakeBadRequest, Message: fmt.Sprintf("malformed handshake: %v", err)}
+}
+
+// putString appends a uint16 length-prefixed string
+func putString(buf *bytes.Buffer, s string) error {
+	if len(s) > 0xffff {
+		return fmt.Errorf("handshake field too long: %d bytes", len(s))
+	}
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+	return nil
+}
+
+// getString reads a uint16 length-prefixed string
+func getString(br *bytes.Reader) (string, error) {
+	var n uint16
+	if err := binary.Read(br, binary.BigEndian, &n); err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(br, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// putMap appends a count followed by sorted key/value pairs
+func putMap(buf *bytes.Buffer, m map[string]string) error {
+	if len(m) > 0xffff {
+		return fmt.Errorf("too many handshake entries: %d", len(m))
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	binary.Write(buf, binary.BigEndian, uint16(len(keys)))
+	for _, k := range keys {
+		if err := putString(buf, k); err != nil {
+			return err
+		}
+		if err := putString(buf, m[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getMap reads a map written by putMap
+func getMap(br *bytes.Reader) (map[string]string, error) {
+	var n uint16
+	if err := binary.Read(br, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string, n)
+	for i := 0; i < int(n); i++ {
+		k, err := getString(br)
+		if err != nil {
+			return nil, err
+		}
+		v, err := getString(br)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
@@ -0,0 +1,166 @@
+package cloudbridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHandshakeRoundTrip(t *testing.T) {
+	req := handshakeRequest{
+		Kind:     StreamKindTunnel,
+		Target:   "localhost:8080",
+		Metadata: map[string]string{metaPeerID: "peer-123", "tenant": "acme"},
+		Options:  map[string]string{"compress": "none"},
+	}
+
+	var buf bytes.Buffer
+	if err := writeHandshake(&buf, req); err != nil {
+		t.Fatalf("writeHandshake() error = %v", err)
+	}
+
+	got, err := readHandshake(&buf)
+	if err != nil {
+		t.Fatalf("readHandshake() error = %v", err)
+	}
+
+	if got.Kind != req.Kind || got.Target != req.Target {
+		t.Errorf("readHandshake() = %+v, want %+v", got, req)
+	}
+	if got.Metadata["tenant"] != "acme" || got.Metadata[metaPeerID] != "peer-123" {
+		t.Errorf("Metadata = %v, want %v", got.Metadata, req.Metadata)
+	}
+	if got.Options["compress"] != "none" {
+		t.Errorf("Options = %v, want %v", got.Options, req.Options)
+	}
+}
+
+func TestReadHandshakeInvalid(t *testing.T) {
+	valid := func() []byte {
+		var buf bytes.Buffer
+		writeHandshake(&buf, handshakeRequest{Kind: StreamKindTunnel, Target: "localhost:80"})
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name     string
+		frame    []byte
+		wantCode HandshakeCode
+	}{
+		{
+			name:     "legacy json",
+			frame:    append([]byte{1, 0, 0, 0, 0, 27}, `{"type":"tunnel","port":80}`...),
+			wantCode: HandshakeBadRequest,
+		},
+		{
+			name: "unsupported version",
+			frame: func() []byte {
+				b := valid()
+				b[frameHeaderSize+len(handshakeMagic)] = 9
+				return b
+			}(),
+			wantCode: HandshakeUnsupportedVersion,
+		},
+		{
+			name:     "truncated",
+			frame:    append([]byte{1, 0, 0, 0, 0, 6}, "CBHS\x01\x01"...),
+			wantCode: HandshakeBadRequest,
+		},
+		{
+			name:     "unsupported frame",
+			frame:    []byte{7, 0, 0, 0, 0, 0},
+			wantCode: HandshakeBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readHandshake(bytes.NewReader(tt.frame))
+
+			var hsErr *HandshakeError
+			if !errors.As(err, &hsErr) {
+				t.Fatalf("readHandshake() error = %v, want *HandshakeError", err)
+			}
+			if hsErr.Code != tt.wantCode {
+				t.Errorf("readHandshake() code = %v, want %v", hsErr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestIncomingHandshakeResponses(t *testing.T) {
+	echoPort := startEchoServer(t)
+
+	// Find a port with nothing listening on it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	closedPort := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	tests := []struct {
+		name     string
+		req      handshakeRequest
+		wantCode HandshakeCode
+	}{
+		{
+			name:     "tunnel accepted",
+			req:      handshakeRequest{Kind: StreamKindTunnel, Target: fmt.Sprintf("127.0.0.1:%d", echoPort)},
+			wantCode: HandshakeOK,
+		},
+		{
+			name:     "target refused",
+			req:      handshakeRequest{Kind: StreamKindTunnel, Target: fmt.Sprintf("127.0.0.1:%d", closedPort)},
+			wantCode: HandshakeTargetUnreachable,
+		},
+		{
+			name:     "remote target",
+			req:      handshakeRequest{Kind: StreamKindTunnel, Target: "example.com:80"},
+			wantCode: HandshakeForbidden,
+		},
+		{
+			name:     "invalid target",
+			req:      handshakeRequest{Kind: StreamKindTunnel, Target: "8080"},
+			wantCode: HandshakeBadRequest,
+		},
+		{
+			name:     "unknown kind",
+			req:      handshakeRequest{Kind: StreamKind(99)},
+			wantCode: HandshakeUnsupportedKind,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newPipeClient(t)
+
+			local, remote := net.Pipe()
+			defer local.Close()
+			server.HandleIncomingConnection(remote)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err := handshake(ctx, local, tt.req)
+			if tt.wantCode == HandshakeOK {
+				if err != nil {
+					t.Errorf("handshake() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var hsErr *HandshakeError
+			if !errors.As(err, &hsErr) {
+				t.Fatalf("handshake() error = %v, want *HandshakeError", err)
+			}
+			if hsErr.Code != tt.wantCode {
+				t.Errorf("handshake() code = %v, want %v", hsErr.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package cloudbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"time"
+)
+
+// httpProxy implements an HTTP forward proxy over CloudBridge
+type httpProxy struct {
+	client    *Client
+	config    proxyConfig
+	forwarder *httputil.ReverseProxy
+}
+
+// HTTPProxy returns an http.Handler that acts as an HTTP forward proxy.
+// CONNECT requests are tunneled to their host:port, and plain requests
+// with an absolute URL are forwarded. Peer addresses (<peer-id>.cb,
+// <service>.<peer-id>.cb) are dialed directly; other hosts go through the
+// exit peer set with WithGatewayPeer. The handler does no authentication,
+// so it should only be served to trusted clients.
+func (c *Client) HTTPProxy(opts ...ProxyOption) http.Handler {
+	p := &httpProxy{
+		client: c,
+		config: newProxyConfig(opts),
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return c.dialProxy(ctx, p.config, addr)
+		},
+		MaxIdleConnsPerHost:   8,
+		IdleConnTimeout:       90 * time.Second,
+		ResponseHeaderTimeout: c.config.Timeout,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	p.forwarder = &httputil.ReverseProxy{
+		// The outgoing request keeps the absolute URL of the proxy request;
+		// hop-by-hop headers have already been removed
+		Rewrite:   func(*httputil.ProxyRequest) {},
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			fmt.Printf("HTTP proxy request to %s failed: %v\n", r.URL.Host, err)
+			http.Error(w, err.Error(), proxyStatus(err))
+		},
+	}
+
+	return p
+}
+
+// ServeHTTP handles one proxy request
+func (p *httpProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.serveConnect(w, r)
+		return
+	}
+
+	if !r.URL.IsAbs() || r.URL.Host == "" {
+		http.Error(w, "proxy requests need an absolute URL", http.StatusBadRequest)
+		return
+	}
+
+	p.forwarder.ServeHTTP(w, r)
+}
+
+// serveConnect tunnels a CONNECT request to its target
+func (p *httpProxy) serveConnect(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "CONNECT is not supported on this connection", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), p.client.config.Timeout)
+	remoteConn, err := p.client.dialProxy(ctx, p.config, r.Host)
+	cancel()
+	if err != nil {
+		fmt.Printf("HTTP proxy CONNECT to %s failed: %v\n", r.Host, err)
+		http.Error(w, err.Error(), proxyStatus(err))
+		return
+	}
+	defer remoteConn.Close()
+
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		fmt.Printf("HTTP proxy CONNECT to %s failed: %v\n", r.Host, err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return
+	}
+
+	go func() {
+		// The client may have sent data along with the request
+		io.Copy(remoteConn, buf.Reader)
+		remoteConn.Close()
+	}()
+	io.Copy(conn, remoteConn)
+}
+
+// proxyStatus maps a dial error to an HTTP status code
+func proxyStatus(err error) int {
+	var hsErr *HandshakeError
+	switch {
+	case errors.As(err, &hsErr) && hsErr.Code == HandshakeForbidden, errors.Is(err, errNoGateway):
+		return http.StatusForbidden
+	case errors.As(err, &hsErr) && hsErr.Code == HandshakeBusy:
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
@@ -0,0 +1,102 @@
+package cloudbridge_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+func TestHTTPProxy(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+	serve(t, network, bob, "bob")
+
+	// Servers reachable from bob's machine
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello from %s", r.URL.Path)
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+
+	proxy := httptest.NewServer(alice.HTTPProxy(cloudbridge.WithGatewayPeer("bob")))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	// The TLS client trusts the test certificate and speaks CONNECT
+	secureTransport := secure.Client().Transport.(*http.Transport).Clone()
+	secureTransport.Proxy = http.ProxyURL(proxyURL)
+	plainTransport := &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+
+	plainPort := plain.Listener.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name       string
+		transport  *http.Transport
+		url        string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "plain request through exit peer",
+			transport:  plainTransport,
+			url:        plain.URL + "/plain",
+			wantStatus: http.StatusOK,
+			wantBody:   "hello from /plain",
+		},
+		{
+			name:       "plain request to peer address",
+			transport:  plainTransport,
+			url:        fmt.Sprintf("http://bob.cb:%d/peer", plainPort),
+			wantStatus: http.StatusOK,
+			wantBody:   "hello from /peer",
+		},
+		{
+			name:       "CONNECT through exit peer",
+			transport:  secureTransport,
+			url:        secure.URL + "/secure",
+			wantStatus: http.StatusOK,
+			wantBody:   "hello from /secure",
+		},
+		{
+			name:       "target denied by exit peer",
+			transport:  plainTransport,
+			url:        "http://10.0.0.5:8080/",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.transport.CloseIdleConnections()
+			client := &http.Client{Transport: tt.transport, Timeout: 5 * time.Second}
+
+			resp, err := client.Get(tt.url)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("StatusCode = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantBody == "" {
+				return
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -1,8 +1,12 @@
 package bridge
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/2gc-dev/relay-client/pkg/api"
@@ -12,6 +16,18 @@ import (
 	quicgo "github.com/quic-go/quic-go"
 )
 
+// Mesh messages travel on peer streams of their own, which start with
+// messageMagic rather than the SDK handshake, followed by the sender's peer
+// ID with a 2-byte length and then the data. The relay does not identify
+// the sender, so the ID is only what the sender claims.
+//
+// This replaces the relay client's own Broadcast and Send: peers using
+// those do not understand these streams, nor do these peers receive theirs.
+const (
+	messageMagic   = "CBMS"
+	maxMessageSize = 1 << 20
+)
+
 // ClientBridge provides integration between SDK and CloudBridge Relay Client
 type ClientBridge struct {
 	config      *BridgeConfig
@@ -20,6 +36,10 @@ type ClientBridge struct {
 	apiManager  *api.Manager
 	authManager *auth.AuthManager
 	logger      Logger
+
+	mu             sync.RWMutex
+	streamHandler  func(stream *IncomingStream)
+	messageHandler func(sender string, data []byte)
 }
 
 // BridgeConfig holds configuration for the bridge
@@ -125,15 +145,20 @@ func (b *ClientBridge) Initialize(ctx context.Context) error {
 	return nil
 }
 
-// ConnectToPeer establishes a connection to a peer
+// ConnectToPeer establishes a connection to a peer. Every call opens a
+// new stream owned by the returned PeerConnection; closing it leaves the
+// peer's other streams alone.
 func (b *ClientBridge) ConnectToPeer(ctx context.Context, peerID string) (*PeerConnection, error) {
+	b.logger.Info("Connecting to peer", "peer_id", peerID)
+	return b.openStream(peerID)
+}
+
+// openStream opens a new stream to peerID through the P2P manager
+func (b *ClientBridge) openStream(peerID string) (*PeerConnection, error) {
 	if b.p2pManager == nil {
 		return nil, fmt.Errorf("P2P manager not initialized")
 	}
 
-	b.logger.Info("Connecting to peer", "peer_id", peerID)
-
-	// Use P2P manager to establish connection
 	p2pConn, err := b.p2pManager.ConnectToPeer(peerID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to peer: %w", err)
@@ -214,15 +239,47 @@ func (b *ClientBridge) Broadcast(ctx context.Context, data []byte) error {
 	if b.p2pManager == nil {
 		return fmt.Errorf("P2P manager not initialized")
 	}
-	return b.p2pManager.Broadcast(data)
+
+	var errs []error
+	for _, peerID := range b.p2pManager.GetConnectedPeers() {
+		if err := b.Send(ctx, peerID, data); err != nil {
+			errs = append(errs, fmt.Errorf("peer %s: %w", peerID, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("errors broadcasting message: %v", errs)
+	}
+	return nil
 }
 
-// Send sends data to a specific peer
+// Send sends data to a specific peer. The message gets a stream of its
+// own from openStream, the same way ConnectToPeer does for SDK sessions,
+// so closing it once written cannot disturb any other stream to the peer.
 func (b *ClientBridge) Send(ctx context.Context, peerID string, data []byte) error {
-	if b.p2pManager == nil {
-		return fmt.Errorf("P2P manager not initialized")
+	if len(data) > maxMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds %d", len(data), maxMessageSize)
+	}
+
+	conn, err := b.openStream(peerID)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+	}
+	sender := b.GetPeerID()
+	frame := make([]byte, 0, len(messageMagic)+2+len(sender)+len(data))
+	frame = append(frame, messageMagic...)
+	frame = binary.BigEndian.AppendUint16(frame, uint16(len(sender)))
+	frame = append(frame, sender...)
+	frame = append(frame, data...)
+	if _, err := conn.Write(frame); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
 	}
-	return b.p2pManager.Send(peerID, data)
+	return nil
 }
 
 // GetMeshPeers returns a list of connected peers in the mesh
@@ -233,13 +290,93 @@ func (b *ClientBridge) GetMeshPeers() []string {
 	return b.p2pManager.GetConnectedPeers()
 }
 
-// SetStreamHandler sets the handler for incoming streams
-func (b *ClientBridge) SetStreamHandler(handler func(stream *quicgo.Stream)) {
+// SetStreamHandler sets the handler for incoming streams other than mesh
+// messages
+func (b *ClientBridge) SetStreamHandler(handler func(stream *IncomingStream)) {
+	b.mu.Lock()
+	b.streamHandler = handler
+	b.mu.Unlock()
+
+	b.listen()
+}
+
+// SetMessageHandler sets the handler for mesh messages sent with Broadcast
+// or Send. sender is the peer ID the sender claims, which is not verified.
+func (b *ClientBridge) SetMessageHandler(handler func(sender string, data []byte)) {
+	b.mu.Lock()
+	b.messageHandler = handler
+	b.mu.Unlock()
+
+	b.listen()
+}
+
+// listen routes the streams opened by peers through accept
+func (b *ClientBridge) listen() {
 	if b.p2pManager != nil {
-		b.p2pManager.SetStreamHandler(handler)
+		b.p2pManager.SetStreamHandler(func(stream *quicgo.Stream) {
+			go b.accept(stream)
+		})
 	}
 }
 
+// accept reads a mesh message from stream, or passes it to the stream
+// handler if it does not carry one
+func (b *ClientBridge) accept(stream *quicgo.Stream) {
+	if b.config.Timeout > 0 {
+		stream.SetReadDeadline(time.Now().Add(b.config.Timeout))
+	}
+	prefix := make([]byte, len(messageMagic))
+	if _, err := io.ReadFull(stream, prefix); err != nil {
+		stream.Close()
+		return
+	}
+
+	b.mu.RLock()
+	streamHandler, messageHandler := b.streamHandler, b.messageHandler
+	b.mu.RUnlock()
+
+	if string(prefix) == messageMagic {
+		defer stream.Close()
+
+		var size [2]byte
+		if _, err := io.ReadFull(stream, size[:]); err != nil {
+			return
+		}
+		sender := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(stream, sender); err != nil {
+			return
+		}
+
+		data, err := io.ReadAll(io.LimitReader(stream, maxMessageSize+1))
+		if err != nil || len(data) > maxMessageSize {
+			b.logger.Warn("Dropping invalid mesh message", "error", err, "size", len(data))
+			return
+		}
+		if messageHandler != nil {
+			messageHandler(string(sender), data)
+		}
+		return
+	}
+
+	stream.SetReadDeadline(time.Time{})
+	if streamHandler == nil {
+		stream.Close()
+		return
+	}
+	streamHandler(&IncomingStream{Stream: stream, reader: io.MultiReader(bytes.NewReader(prefix), stream)})
+}
+
+// IncomingStream is a stream opened by a remote peer
+type IncomingStream struct {
+	*quicgo.Stream
+	reader io.Reader
+}
+
+// Read reads data from the stream
+func (s *IncomingStream) Read(b []byte) (int, error) {
+	return s.reader.Read(b)
+}
+
 // PeerConnection represents a connection to a peer through the bridge
 type PeerConnection struct {
 	PeerID      string
@@ -271,3 +408,28 @@ func (pc *PeerConnection) Close() error {
 	}
 	return nil
 }
+
+// SetDeadline sets the read and write deadlines on the underlying QUIC stream.
+// Operations that exceed a deadline fail with an error wrapping os.ErrDeadlineExceeded.
+func (pc *PeerConnection) SetDeadline(t time.Time) error {
+	if pc.p2pConn == nil || pc.p2pConn.Stream == nil {
+		return fmt.Errorf("connection not established")
+	}
+	return pc.p2pConn.Stream.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline on the underlying QUIC stream
+func (pc *PeerConnection) SetReadDeadline(t time.Time) error {
+	if pc.p2pConn == nil || pc.p2pConn.Stream == nil {
+		return fmt.Errorf("connection not established")
+	}
+	return pc.p2pConn.Stream.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline on the underlying QUIC stream
+func (pc *PeerConnection) SetWriteDeadline(t time.Time) error {
+	if pc.p2pConn == nil || pc.p2pConn.Stream == nil {
+		return fmt.Errorf("connection not established")
+	}
+	return pc.p2pConn.Stream.SetWriteDeadline(t)
+}
@@ -0,0 +1,140 @@
+package cloudbridge
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// listenBacklog is the number of streams a listener queues for Accept.
+// Further streams are rejected with HandshakeBusy.
+const listenBacklog = 128
+
+// listener implements net.Listener for streams of one protocol
+type listener struct {
+	client     *Client
+	protocolID string
+	conns      chan Connection
+	slots      chan struct{} // reserves room in conns before a stream is acknowledged
+	mu         sync.Mutex    // orders queueing streams against shutdown
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// Listen returns a listener yielding incoming streams for protocolID as
+// net.Conn values. Peers reach it with ConnectProtocol; Serve must be
+// running for streams to arrive. Only one handler or listener can be
+// registered per protocol. Up to 128 streams wait to be accepted; peers
+// opening more are rejected with HandshakeBusy.
+func (c *Client) Listen(protocolID string) (net.Listener, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, errors.New("client is closed")
+	}
+
+	if protocolID == "" {
+		return nil, errors.New("protocol ID cannot be empty")
+	}
+
+	if _, exists := c.handlers[protocolID]; exists {
+		return nil, fmt.Errorf("protocol %s already has a handler", protocolID)
+	}
+
+	l := &listener{
+		client:     c,
+		protocolID: protocolID,
+		conns:      make(chan Connection, listenBacklog),
+		slots:      make(chan struct{}, listenBacklog),
+		done:       make(chan struct{}),
+	}
+	c.handlers[protocolID] = l.handle
+	c.listeners[l] = struct{}{}
+
+	return l, nil
+}
+
+// reserve takes a place in the backlog for a stream about to be handled.
+// It reports false if the backlog is full.
+func (l *listener) reserve() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release gives up a place taken by reserve
+func (l *listener) release() {
+	<-l.slots
+}
+
+// handle queues an incoming stream, for which reserve took a place, until
+// it is accepted
+func (l *listener) handle(conn Connection) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-l.done:
+		l.release()
+		conn.Close()
+	default:
+		l.conns <- conn
+	}
+}
+
+// Accept waits for the next incoming stream
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		l.release()
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops the listener and unregisters its protocol.
+// Connections already accepted are not affected.
+func (l *listener) Close() error {
+	l.shutdown()
+
+	l.client.mu.Lock()
+	defer l.client.mu.Unlock()
+
+	// The listener owns the protocol's handler only while it is registered;
+	// Handle unregisters it when replacing the handler
+	if _, ok := l.client.listeners[l]; ok {
+		delete(l.client.listeners, l)
+		delete(l.client.handlers, l.protocolID)
+	}
+	return nil
+}
+
+// shutdown unblocks Accept and closes the streams waiting to be accepted
+func (l *listener) shutdown() {
+	l.closeOnce.Do(func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		close(l.done)
+		for {
+			select {
+			case conn := <-l.conns:
+				l.release()
+				conn.Close()
+			default:
+				return
+			}
+		}
+	})
+}
+
+// Addr returns the local peer address
+func (l *listener) Addr() net.Addr {
+	return PeerAddr{PeerID: l.client.transport.LocalPeerID()}
+}
@@ -0,0 +1,176 @@
+package cloudbridge_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+func TestListenHTTP(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+
+	listener, err := bob.Listen("/http/1.1")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	if _, err := bob.Listen("/http/1.1"); err == nil {
+		t.Error("second Listen() on the same protocol should fail")
+	}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "hello %s", r.RemoteAddr)
+		}),
+	}
+	go server.Serve(listener)
+	defer server.Close()
+	serve(t, network, bob, "bob")
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return alice.ConnectProtocol(ctx, "bob", "/http/1.1")
+			},
+		},
+		Timeout: 5 * time.Second,
+	}
+	defer httpClient.CloseIdleConnections()
+
+	resp, err := httpClient.Get("http://bob/")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(body) != "hello alice" {
+		t.Errorf("body = %q, want %q", body, "hello alice")
+	}
+}
+
+func TestListenerClose(t *testing.T) {
+	network := memtransport.NewNetwork()
+	bob := newTestClient(t, network, "bob")
+
+	listener, err := bob.Listen("/test/1.0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	accepted := make(chan error, 1)
+	go func() {
+		_, err := listener.Accept()
+		accepted <- err
+	}()
+
+	if err := listener.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	select {
+	case err := <-accepted:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Accept() error = %v, want net.ErrClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Accept() did not return after Close()")
+	}
+
+	// The protocol can be registered again once the listener is closed
+	if _, err := bob.Listen("/test/1.0"); err != nil {
+		t.Errorf("Listen() after Close() error = %v", err)
+	}
+}
+
+func TestHandleReplacesListener(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+
+	listener, err := bob.Listen("/test/1.0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	bob.Handle("/test/1.0", func(conn cloudbridge.Connection) {
+		defer conn.Close()
+		conn.Write([]byte("handler"))
+	})
+	if _, err := listener.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Accept() after Handle() error = %v, want net.ErrClosed", err)
+	}
+
+	// Closing the replaced listener must leave the new handler in place
+	listener.Close()
+	serve(t, network, bob, "bob")
+
+	conn, err := alice.ConnectProtocol(context.Background(), "bob", "/test/1.0")
+	if err != nil {
+		t.Fatalf("ConnectProtocol() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	data, err := io.ReadAll(conn)
+	if err != nil || string(data) != "handler" {
+		t.Errorf("ReadAll() = %q, %v, want %q", data, err, "handler")
+	}
+}
+
+func TestListenerBacklog(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+
+	listener, err := bob.Listen("/backlog")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+	serve(t, network, bob, "bob")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Nothing accepts, so streams queue until the backlog is full
+	var rejected error
+	for i := 0; i < 1000; i++ {
+		conn, err := alice.ConnectProtocol(ctx, "bob", "/backlog")
+		if err != nil {
+			rejected = err
+			break
+		}
+		defer conn.Close()
+	}
+
+	var hsErr *cloudbridge.HandshakeError
+	if !errors.As(rejected, &hsErr) || hsErr.Code != cloudbridge.HandshakeBusy {
+		t.Fatalf("ConnectProtocol() beyond the backlog error = %v, want HandshakeBusy", rejected)
+	}
+
+	// Accepting a stream makes room for another
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+	conn.Close()
+
+	next, err := alice.ConnectProtocol(ctx, "bob", "/backlog")
+	if err != nil {
+		t.Fatalf("ConnectProtocol() after Accept() error = %v", err)
+	}
+	next.Close()
+}
@@ -0,0 +1,227 @@
+// Package memtransport provides an in-process cloudbridge.Transport.
+//
+// A Network plays the role of the CloudBridge relay: every Transport created
+// from the same Network sees the others as mesh peers and can open streams to
+// them. It is intended for tests and local development where a live relay is
+// not available.
+//
+//	network := memtransport.NewNetwork()
+//	alice, _ := cloudbridge.NewClient(
+//		cloudbridge.WithToken("test-token"),
+//		cloudbridge.WithTransport(network.NewTransport("alice")),
+//	)
+package memtransport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+)
+
+// Network is an in-memory relay connecting a set of transports
+type Network struct {
+	mu    sync.RWMutex
+	peers map[string]*Transport
+}
+
+// NewNetwork creates an empty in-memory network
+func NewNetwork() *Network {
+	return &Network{
+		peers: make(map[string]*Transport),
+	}
+}
+
+// NewTransport creates a transport for peerID attached to the network.
+// An existing transport with the same peer ID is replaced.
+func (n *Network) NewTransport(peerID string) *Transport {
+	t := &Transport{
+		network: n,
+		peerID:  peerID,
+	}
+
+	n.mu.Lock()
+	n.peers[peerID] = t
+	n.mu.Unlock()
+
+	return t
+}
+
+// lookup returns the transport registered for peerID
+func (n *Network) lookup(peerID string) (*Transport, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	t, ok := n.peers[peerID]
+	return t, ok
+}
+
+// remove detaches a transport from the network
+func (n *Network) remove(t *Transport) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.peers[t.peerID] == t {
+		delete(n.peers, t.peerID)
+	}
+}
+
+// peerIDs returns the sorted IDs of all peers except exclude
+func (n *Network) peerIDs(exclude string) []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	peers := make([]string, 0, len(n.peers))
+	for id := range n.peers {
+		if id != exclude {
+			peers = append(peers, id)
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// Transport implements cloudbridge.Transport on top of a Network
+type Transport struct {
+	network *Network
+	peerID  string
+	mu      sync.RWMutex
+	closed  bool
+	handler cloudbridge.StreamHandler
+
+	messageHandler cloudbridge.MessageHandler
+}
+
+// ConnectToPeer opens an in-memory stream to peerID.
+// The remote peer must have a stream handler installed (see Client.Serve).
+func (t *Transport) ConnectToPeer(ctx context.Context, peerID string) (cloudbridge.Stream, error) {
+	if err := t.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	remote, ok := t.network.lookup(peerID)
+	if !ok {
+		return nil, fmt.Errorf("peer not found: %s", peerID)
+	}
+
+	remote.mu.RLock()
+	handler := remote.handler
+	closed := remote.closed
+	remote.mu.RUnlock()
+
+	if closed {
+		return nil, fmt.Errorf("peer not found: %s", peerID)
+	}
+	if handler == nil {
+		return nil, fmt.Errorf("peer %s is not accepting streams", peerID)
+	}
+
+	local, accepted := net.Pipe()
+	go handler(t.peerID, accepted)
+
+	return local, nil
+}
+
+// Broadcast delivers data to all other peers on the network
+func (t *Transport) Broadcast(ctx context.Context, data []byte) error {
+	if err := t.checkOpen(); err != nil {
+		return err
+	}
+
+	for _, peerID := range t.network.peerIDs(t.peerID) {
+		if remote, ok := t.network.lookup(peerID); ok {
+			remote.deliver(t.peerID, data)
+		}
+	}
+	return nil
+}
+
+// Send delivers data to a specific peer, which must exist on the network
+func (t *Transport) Send(ctx context.Context, peerID string, data []byte) error {
+	if err := t.checkOpen(); err != nil {
+		return err
+	}
+
+	remote, ok := t.network.lookup(peerID)
+	if !ok {
+		return fmt.Errorf("peer not found: %s", peerID)
+	}
+
+	remote.deliver(t.peerID, data)
+	return nil
+}
+
+// deliver passes a mesh message to the message handler, if one is set.
+// Like messages over the relay, it is handled asynchronously.
+func (t *Transport) deliver(from string, data []byte) {
+	t.mu.RLock()
+	handler := t.messageHandler
+	t.mu.RUnlock()
+
+	if handler != nil {
+		go handler(from, append([]byte(nil), data...))
+	}
+}
+
+// GetMeshPeers returns all other peers on the network
+func (t *Transport) GetMeshPeers() []string {
+	if t.checkOpen() != nil {
+		return []string{}
+	}
+	return t.network.peerIDs(t.peerID)
+}
+
+// SetStreamHandler sets the handler for incoming streams
+func (t *Transport) SetStreamHandler(handler cloudbridge.StreamHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handler = handler
+}
+
+// SetMessageHandler sets the handler for mesh messages
+func (t *Transport) SetMessageHandler(handler cloudbridge.MessageHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messageHandler = handler
+}
+
+// LocalPeerID returns the peer ID of this transport
+func (t *Transport) LocalPeerID() string {
+	return t.peerID
+}
+
+// Close detaches the transport from the network
+func (t *Transport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+
+	t.closed = true
+	t.network.remove(t)
+
+	return nil
+}
+
+// checkOpen returns an error if the transport has been closed
+func (t *Transport) checkOpen() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return errors.New("transport is closed")
+	}
+	return nil
+}
+
+var _ cloudbridge.Transport = (*Transport)(nil)
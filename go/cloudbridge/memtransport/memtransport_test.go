@@ -0,0 +1,71 @@
+package memtransport
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTransportClose(t *testing.T) {
+	network := NewNetwork()
+	alice := network.NewTransport("alice")
+	bob := network.NewTransport("bob")
+
+	if err := bob.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if peers := alice.GetMeshPeers(); len(peers) != 0 {
+		t.Errorf("GetMeshPeers() after peer Close() = %v, want []", peers)
+	}
+
+	if _, err := bob.ConnectToPeer(context.Background(), "alice"); err == nil {
+		t.Error("ConnectToPeer() on closed transport should fail")
+	}
+
+	// Second close should be idempotent
+	if err := bob.Close(); err != nil {
+		t.Errorf("Second Close() error = %v", err)
+	}
+}
+
+func TestMessageDelivery(t *testing.T) {
+	network := NewNetwork()
+	alice := network.NewTransport("alice")
+	bob := network.NewTransport("bob")
+	carol := network.NewTransport("carol")
+
+	received := make(chan string, 4)
+	for _, tr := range []*Transport{bob, carol} {
+		tr := tr
+		tr.SetMessageHandler(func(peerID string, data []byte) {
+			received <- tr.LocalPeerID() + " <- " + peerID + ": " + string(data)
+		})
+	}
+
+	ctx := context.Background()
+	if err := alice.Broadcast(ctx, []byte("all")); err != nil {
+		t.Fatalf("Broadcast() error = %v", err)
+	}
+	if err := alice.Send(ctx, "bob", []byte("one")); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if err := alice.Send(ctx, "nobody", []byte("lost")); err == nil {
+		t.Error("Send() to unknown peer error = nil, want error")
+	}
+
+	got := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-received:
+			got[msg] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for messages, got %v", got)
+		}
+	}
+	for _, want := range []string{"bob <- alice: all", "carol <- alice: all", "bob <- alice: one"} {
+		if !got[want] {
+			t.Errorf("messages = %v, missing %q", got, want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package cloudbridge
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 )
 
@@ -17,7 +18,9 @@ type Mesh interface {
 	// Send sends a message to a specific peer
 	Send(ctx context.Context, peerID string, data []byte) error
 
-	// Messages returns a channel for receiving messages
+	// Messages returns a channel for receiving the messages peers send
+	// with Broadcast or Send. Messages arriving while the channel is full
+	// are dropped; it is closed by Leave.
 	Messages() <-chan Message
 
 	// Peers returns a list of connected peers
@@ -27,7 +30,9 @@ type Mesh interface {
 	Leave() error
 }
 
-// Message represents a message received from the mesh
+// Message represents a message received from the mesh.
+// Over the relay, which cannot identify senders, From is the peer ID the
+// sender claims and is not verified.
 type Message struct {
 	From string
 	Data []byte
@@ -55,7 +60,7 @@ func (m *mesh) join(ctx context.Context) error {
 	m.peers = make(map[string]bool)
 	
 	// Get initial peers
-	peers := m.client.transport.getMeshPeers()
+	peers := m.client.transport.GetMeshPeers()
 	for _, peer := range peers {
 		m.peers[peer] = true
 	}
@@ -77,7 +82,7 @@ func (m *mesh) Broadcast(ctx context.Context, data []byte) error {
 	}
 	m.mu.RUnlock()
 
-	return m.client.transport.broadcast(ctx, data)
+	return m.client.transport.Broadcast(ctx, data)
 }
 
 // Send sends a message to a specific peer
@@ -93,7 +98,7 @@ func (m *mesh) Send(ctx context.Context, peerID string, data []byte) error {
 		return errors.New("peer ID cannot be empty")
 	}
 
-	return m.client.transport.send(ctx, peerID, data)
+	return m.client.transport.Send(ctx, peerID, data)
 }
 
 // Messages returns a channel for receiving messages
@@ -101,13 +106,29 @@ func (m *mesh) Messages() <-chan Message {
 	return m.messages
 }
 
+// deliver queues a received message for Messages, dropping it if the
+// channel is full
+func (m *mesh) deliver(msg Message) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return
+	}
+	select {
+	case m.messages <- msg:
+	default:
+		fmt.Printf("mesh %s: dropping message from %s, Messages is full\n", m.networkName, msg.From)
+	}
+}
+
 // Peers returns a list of connected peers
 func (m *mesh) Peers() []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	// Refresh peers from transport
-	currentPeers := m.client.transport.getMeshPeers()
+	currentPeers := m.client.transport.GetMeshPeers()
 	
 	// Update local cache if needed (optional, for now just return current)
 	return currentPeers
@@ -115,6 +136,12 @@ func (m *mesh) Peers() []string {
 
 // Leave leaves the mesh network
 func (m *mesh) Leave() error {
+	if m.client != nil {
+		m.client.mu.Lock()
+		delete(m.client.meshes, m)
+		m.client.mu.Unlock()
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
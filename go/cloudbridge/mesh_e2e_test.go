@@ -0,0 +1,77 @@
+package cloudbridge_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+func TestJoinMeshPeers(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	newTestClient(t, network, "bob")
+	newTestClient(t, network, "charlie")
+
+	mesh, err := alice.JoinMesh(context.Background(), "test-network")
+	if err != nil {
+		t.Fatalf("JoinMesh() error = %v", err)
+	}
+	defer mesh.Leave()
+
+	peers := mesh.Peers()
+	if len(peers) != 2 || peers[0] != "bob" || peers[1] != "charlie" {
+		t.Errorf("Peers() = %v, want [bob charlie]", peers)
+	}
+
+	if err := mesh.Send(context.Background(), "bob", []byte("hi")); err != nil {
+		t.Errorf("Send() error = %v", err)
+	}
+}
+
+func TestMeshMessages(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+	ctx := context.Background()
+
+	aliceMesh, err := alice.JoinMesh(ctx, "test-network")
+	if err != nil {
+		t.Fatalf("JoinMesh() error = %v", err)
+	}
+	defer aliceMesh.Leave()
+
+	bobMesh, err := bob.JoinMesh(ctx, "test-network")
+	if err != nil {
+		t.Fatalf("JoinMesh() error = %v", err)
+	}
+
+	// Registry traffic stays out of Messages
+	if err := alice.RegisterService(ctx, cloudbridge.ServiceConfig{Name: "api", Port: 8080}); err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+	if err := aliceMesh.Broadcast(ctx, []byte("hello")); err != nil {
+		t.Fatalf("Broadcast() error = %v", err)
+	}
+
+	select {
+	case msg := <-bobMesh.Messages():
+		if msg.From != "alice" || string(msg.Data) != "hello" {
+			t.Errorf("Messages() = %s from %q, want hello from alice", msg.Data, msg.From)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message")
+	}
+
+	if err := bobMesh.Leave(); err != nil {
+		t.Fatalf("Leave() error = %v", err)
+	}
+	if err := aliceMesh.Broadcast(ctx, []byte("after leave")); err != nil {
+		t.Fatalf("Broadcast() error = %v", err)
+	}
+	if _, ok := <-bobMesh.Messages(); ok {
+		t.Error("Messages() after Leave() is open, want closed")
+	}
+}
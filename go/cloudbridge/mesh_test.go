@@ -277,3 +277,30 @@ func TestMeshConcurrentOperations(t *testing.T) {
 	<-done
 }
 
+
+func TestMeshMessagesClaimedSender(t *testing.T) {
+	client, _ := newPipeClient(t)
+
+	m, err := client.JoinMesh(context.Background(), "test-network")
+	if err != nil {
+		t.Fatalf("JoinMesh() error = %v", err)
+	}
+	defer m.Leave()
+
+	// The claimed sender is reported, but not trusted by the registry
+	client.handleMessage("", "peer-a", []byte("hello"))
+	client.handleMessage("", "peer-a", announcement(t, "peer-a", "", 1, time.Minute, "api"))
+
+	select {
+	case msg := <-m.Messages():
+		if msg.From != "peer-a" || string(msg.Data) != "hello" {
+			t.Errorf("Messages() = %s from %q, want hello from peer-a", msg.Data, msg.From)
+		}
+	default:
+		t.Fatal("Messages() is empty, want a message")
+	}
+
+	if services, _ := client.DiscoverServices(context.Background(), "api"); len(services) != 0 {
+		t.Errorf("DiscoverServices() = %+v, want none from a peer outside the mesh", services)
+	}
+}
@@ -0,0 +1,316 @@
+package cloudbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Frame format (all integers big-endian):
+//
+//	+---------+-------+----------------+-----------------+
+//	| version | flags | length (4)     | payload         |
+//	+---------+-------+----------------+-----------------+
+//
+// Version 1 defines no flags; receivers reject frames with unknown flags.
+const (
+	frameVersion    = 1
+	frameHeaderSize = 6
+
+	// maxHandshakeSize limits the handshake frame read from incoming streams
+	maxHandshakeSize = 4096
+
+	// DefaultMaxMessageSize is the default limit for a single message payload
+	DefaultMaxMessageSize = 4 << 20
+)
+
+var (
+	// ErrMessageTooLarge is returned when a message exceeds the maximum size
+	ErrMessageTooLarge = errors.New("message exceeds maximum size")
+
+	// ErrUnsupportedFrame is returned when a frame has an unknown version or flags
+	ErrUnsupportedFrame = errors.New("unsupported frame")
+)
+
+// Codec encodes typed values into message payloads
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec encodes values with encoding/json
+var JSONCodec Codec = jsonCodec{}
+
+// BinaryCodec encodes []byte, encoding.BinaryMarshaler implementations and
+// fixed-size values (see encoding/binary) in big-endian byte order
+var BinaryCodec Codec = binaryCodec{}
+
+// MessageConfig configures a MessageConn
+type MessageConfig struct {
+	MaxMessageSize int   // payload limit in bytes, DefaultMaxMessageSize if zero
+	Codec          Codec // codec for Send and Receive, JSONCodec if nil
+}
+
+// MessageConn exchanges length-prefixed messages over a Connection.
+// SendMessage and ReceiveMessage bind the connection deadlines to ctx, so
+// deadlines set directly on the connection are overridden while they run.
+// After an error that leaves a frame partially sent or received, every
+// further call in that direction returns the same error.
+type MessageConn interface {
+	// SendMessage sends data as a single message
+	SendMessage(ctx context.Context, data []byte) error
+
+	// ReceiveMessage waits for the next message
+	ReceiveMessage(ctx context.Context) ([]byte, error)
+
+	// Send encodes v with the configured codec and sends it
+	Send(ctx context.Context, v any) error
+
+	// Receive receives the next message and decodes it into v
+	Receive(ctx context.Context, v any) error
+
+	// Conn returns the underlying connection
+	Conn() Connection
+
+	// Close closes the underlying connection
+	Close() error
+}
+
+// messageConn implements the MessageConn interface
+type messageConn struct {
+	conn     Connection
+	maxSize  int
+	codec    Codec
+	readMu   sync.Mutex
+	readErr  error
+	writeMu  sync.Mutex
+	writeErr error
+}
+
+// NewMessageConn wraps conn for message exchange
+func NewMessageConn(conn Connection, config MessageConfig) MessageConn {
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if config.Codec == nil {
+		config.Codec = JSONCodec
+	}
+
+	return &messageConn{
+		conn:    conn,
+		maxSize: config.MaxMessageSize,
+		codec:   config.Codec,
+	}
+}
+
+// SendMessage sends data as a single message
+func (m *messageConn) SendMessage(ctx context.Context, data []byte) error {
+	if len(data) > m.maxSize {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrMessageTooLarge, len(data), m.maxSize)
+	}
+
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+
+	if m.writeErr != nil {
+		return m.writeErr
+	}
+
+	var started bool
+	err := withDeadline(ctx, m.conn.SetWriteDeadline, func() error {
+		var err error
+		started, err = writeFrame(m.conn, data)
+		return err
+	})
+	if err != nil && started {
+		m.writeErr = fmt.Errorf("message stream broken: %w", err)
+	}
+	return err
+}
+
+// ReceiveMessage waits for the next message
+func (m *messageConn) ReceiveMessage(ctx context.Context) ([]byte, error) {
+	m.readMu.Lock()
+	defer m.readMu.Unlock()
+
+	if m.readErr != nil {
+		return nil, m.readErr
+	}
+
+	var data []byte
+	var started bool
+	err := withDeadline(ctx, m.conn.SetReadDeadline, func() error {
+		var err error
+		data, started, err = readFrame(m.conn, m.maxSize)
+		return err
+	})
+	if err != nil {
+		if started {
+			m.readErr = fmt.Errorf("message stream broken: %w", err)
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Send encodes v with the configured codec and sends it
+func (m *messageConn) Send(ctx context.Context, v any) error {
+	data, err := m.codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	return m.SendMessage(ctx, data)
+}
+
+// Receive receives the next message and decodes it into v
+func (m *messageConn) Receive(ctx context.Context, v any) error {
+	data, err := m.ReceiveMessage(ctx)
+	if err != nil {
+		return err
+	}
+	if err := m.codec.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode message: %w", err)
+	}
+	return nil
+}
+
+// Conn returns the underlying connection
+func (m *messageConn) Conn() Connection {
+	return m.conn
+}
+
+// Close closes the underlying connection
+func (m *messageConn) Close() error {
+	return m.conn.Close()
+}
+
+// writeFrame writes payload as one frame.
+// started reports whether any bytes of the frame were written.
+func writeFrame(w io.Writer, payload []byte) (started bool, err error) {
+	frame := make([]byte, frameHeaderSize+len(payload))
+	frame[0] = frameVersion
+	binary.BigEndian.PutUint32(frame[2:frameHeaderSize], uint32(len(payload)))
+	copy(frame[frameHeaderSize:], payload)
+
+	n, err := w.Write(frame)
+	return n > 0, err
+}
+
+// readFrame reads one frame and returns its payload.
+// started reports whether any bytes of the frame were consumed.
+func readFrame(r io.Reader, maxSize int) (payload []byte, started bool, err error) {
+	var header [frameHeaderSize]byte
+	n, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return nil, n > 0, err
+	}
+
+	if header[0] != frameVersion || header[1] != 0 {
+		return nil, true, fmt.Errorf("%w: version %d, flags %#x", ErrUnsupportedFrame, header[0], header[1])
+	}
+
+	size := binary.BigEndian.Uint32(header[2:])
+	if uint64(size) > uint64(maxSize) {
+		return nil, true, fmt.Errorf("%w: %d bytes, limit %d", ErrMessageTooLarge, size, maxSize)
+	}
+
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, true, err
+	}
+	return payload, true, nil
+}
+
+// withDeadline runs fn with setDeadline bound to ctx: the ctx deadline is
+// applied up front and cancellation interrupts fn by expiring the deadline
+func withDeadline(ctx context.Context, setDeadline func(time.Time) error, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	deadline, hasDeadline := ctx.Deadline()
+	setDeadline(deadline)
+	defer setDeadline(time.Time{})
+
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		setDeadline(time.Now())
+		close(interrupted)
+	})
+
+	err := fn()
+	if !stop() {
+		// Let the interrupt finish before the deadline is reset
+		<-interrupted
+	}
+
+	if err != nil {
+		// Report why ctx ended rather than the resulting I/O timeout
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if hasDeadline && errors.Is(err, os.ErrDeadlineExceeded) && !time.Now().Before(deadline) {
+			return context.DeadlineExceeded
+		}
+	}
+	return err
+}
+
+// jsonCodec implements Codec with encoding/json
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// binaryCodec implements Codec without a schema compiler
+type binaryCodec struct{}
+
+func (binaryCodec) Marshal(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case encoding.BinaryMarshaler:
+		return v.MarshalBinary()
+	}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (binaryCodec) Unmarshal(data []byte, v any) error {
+	switch v := v.(type) {
+	case *[]byte:
+		*v = append((*v)[:0], data...)
+		return nil
+	case encoding.BinaryUnmarshaler:
+		return v.UnmarshalBinary(data)
+	}
+
+	r := bytes.NewReader(data)
+	if err := binary.Read(r, binary.BigEndian, v); err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%d trailing bytes after value", r.Len())
+	}
+	return nil
+}
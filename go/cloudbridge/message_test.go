@@ -0,0 +1,177 @@
+package cloudbridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// newMessagePair returns two message connections joined by a pipe
+func newMessagePair(t *testing.T, config MessageConfig) (MessageConn, MessageConn) {
+	t.Helper()
+
+	local, remote := net.Pipe()
+	t.Cleanup(func() {
+		local.Close()
+		remote.Close()
+	})
+
+	a := NewMessageConn(&connection{peerID: "peer-a", connected: true, bridgeConn: local}, config)
+	b := NewMessageConn(&connection{peerID: "peer-b", connected: true, bridgeConn: remote}, config)
+	return a, b
+}
+
+func TestMessageConnRoundTrip(t *testing.T) {
+	a, b := newMessagePair(t, MessageConfig{})
+	ctx := context.Background()
+
+	messages := [][]byte{[]byte("hello"), {}, bytes.Repeat([]byte("x"), 70000)}
+
+	go func() {
+		for _, msg := range messages {
+			if err := a.SendMessage(ctx, msg); err != nil {
+				t.Errorf("SendMessage() error = %v", err)
+				return
+			}
+		}
+	}()
+
+	for i, want := range messages {
+		got, err := b.ReceiveMessage(ctx)
+		if err != nil {
+			t.Fatalf("ReceiveMessage() error = %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("message %d = %d bytes, want %d bytes", i, len(got), len(want))
+		}
+	}
+}
+
+func TestMessageConnMaxSize(t *testing.T) {
+	a, b := newMessagePair(t, MessageConfig{MaxMessageSize: 16})
+	ctx := context.Background()
+
+	err := a.SendMessage(ctx, make([]byte, 17))
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("SendMessage() error = %v, want ErrMessageTooLarge", err)
+	}
+
+	// A peer with a larger limit sends an oversized frame
+	go writeFrame(a.Conn(), make([]byte, 32))
+
+	if _, err := b.ReceiveMessage(ctx); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("ReceiveMessage() error = %v, want ErrMessageTooLarge", err)
+	}
+
+	// The stream is out of sync after a rejected frame
+	if _, err := b.ReceiveMessage(ctx); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("ReceiveMessage() after broken frame error = %v, want ErrMessageTooLarge", err)
+	}
+}
+
+func TestMessageConnUnsupportedVersion(t *testing.T) {
+	a, b := newMessagePair(t, MessageConfig{})
+
+	go a.Conn().Write([]byte{2, 0, 0, 0, 0, 1, 'x'})
+
+	if _, err := b.ReceiveMessage(context.Background()); !errors.Is(err, ErrUnsupportedFrame) {
+		t.Errorf("ReceiveMessage() error = %v, want ErrUnsupportedFrame", err)
+	}
+}
+
+func TestMessageConnContext(t *testing.T) {
+	a, b := newMessagePair(t, MessageConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := b.ReceiveMessage(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ReceiveMessage() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	if _, err := b.ReceiveMessage(cancelled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ReceiveMessage() error = %v, want context.Canceled", err)
+	}
+
+	// Nothing was consumed, so the connection is still usable
+	go a.SendMessage(context.Background(), []byte("after timeout"))
+
+	got, err := b.ReceiveMessage(context.Background())
+	if err != nil {
+		t.Fatalf("ReceiveMessage() error = %v", err)
+	}
+	if string(got) != "after timeout" {
+		t.Errorf("ReceiveMessage() = %q, want %q", got, "after timeout")
+	}
+}
+
+func TestMessageConnCodecs(t *testing.T) {
+	type point struct {
+		X, Y int32
+	}
+
+	tests := []struct {
+		name  string
+		codec Codec
+		send  any
+		recv  func() any
+	}{
+		{
+			name:  "json struct",
+			codec: JSONCodec,
+			send:  map[string]string{"type": "ping"},
+			recv:  func() any { return &map[string]string{} },
+		},
+		{
+			name:  "binary fixed-size",
+			codec: BinaryCodec,
+			send:  point{X: 3, Y: -4},
+			recv:  func() any { return &point{} },
+		},
+		{
+			name:  "binary bytes",
+			codec: BinaryCodec,
+			send:  []byte{1, 2, 3},
+			recv:  func() any { return &[]byte{} },
+		},
+		{
+			name:  "binary marshaler",
+			codec: BinaryCodec,
+			send:  time.Date(2025, 11, 1, 12, 0, 0, 0, time.UTC),
+			recv:  func() any { return &time.Time{} },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := newMessagePair(t, MessageConfig{Codec: tt.codec})
+			ctx := context.Background()
+
+			go a.Send(ctx, tt.send)
+
+			got := tt.recv()
+			if err := b.Receive(ctx, got); err != nil {
+				t.Fatalf("Receive() error = %v", err)
+			}
+
+			want, _ := tt.codec.Marshal(tt.send)
+			gotData, _ := tt.codec.Marshal(got)
+			if !bytes.Equal(gotData, want) {
+				t.Errorf("Receive() = %v, want %v", got, tt.send)
+			}
+		})
+	}
+}
+
+func TestBinaryCodecTrailingBytes(t *testing.T) {
+	var v int16
+	if err := BinaryCodec.Unmarshal([]byte{0, 1, 2}, &v); err == nil {
+		t.Error("Unmarshal() with trailing bytes should fail")
+	}
+}
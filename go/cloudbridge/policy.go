@@ -0,0 +1,264 @@
+package cloudbridge
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TunnelPolicy is an allow-list for inbound tunnels. A peer may reach a
+// target, or bind a port with a reverse tunnel, only if a rule allows it;
+// everything else is denied in the handshake with HandshakeForbidden and
+// logged. An empty policy denies all inbound tunnels.
+//
+// Without a policy, peers may reach any port on the local machine but may
+// not bind ports for reverse tunnels.
+//
+// Peers are identified by the peer ID the transport authenticated, never by
+// what the dialer claims in its handshake. Rules that name peers do not
+// apply to streams whose transport cannot identify the remote peer. The
+// relay transport cannot identify any, so NewClient rejects policies that
+// name peers unless another transport, such as memtransport, is used.
+type TunnelPolicy struct {
+	Rules []TunnelRule
+
+	// ListenHost is the IP address reverse tunnels bind their ports on
+	// (default: 127.0.0.1). Use "0.0.0.0" or "::" to accept connections
+	// from other machines.
+	ListenHost string
+}
+
+// TunnelRule allows a set of peers to reach a set of targets
+type TunnelRule struct {
+	// PeerIDs selects the peers the rule applies to; "*" matches any peer.
+	// Named peers need a transport that identifies peers; see TunnelPolicy.
+	// Tenants may only be "*": the handshake carries no proof of the
+	// dialer's tenant, so named tenants are rejected.
+	PeerIDs []string
+	Tenants []string
+
+	// Targets are host:port patterns. The host is a hostname, an IP address,
+	// a CIDR block such as 10.0.0.0/8, "localhost" for any loopback address,
+	// or "*". The port is a number, a range such as 8000-8999, or "*".
+	// Hostnames are compared as written and are not resolved.
+	Targets []string
+
+	// ListenPorts are the ports the peers may bind with reverse tunnels
+	ListenPorts []int
+}
+
+// namesPeers reports whether any rule selects peers by ID
+func (p *TunnelPolicy) namesPeers() bool {
+	for _, rule := range p.Rules {
+		for _, id := range rule.PeerIDs {
+			if id != "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validate checks that every rule selects peers and parses
+func (p *TunnelPolicy) validate() error {
+	if p.ListenHost != "" && net.ParseIP(p.ListenHost) == nil {
+		return fmt.Errorf("invalid listen host %q", p.ListenHost)
+	}
+	for i, rule := range p.Rules {
+		if len(rule.PeerIDs) == 0 && len(rule.Tenants) == 0 {
+			return fmt.Errorf("tunnel rule %d selects no peers", i)
+		}
+		for _, tenant := range rule.Tenants {
+			if tenant != "*" {
+				return fmt.Errorf("tunnel rule %d: tenant %q cannot be verified; select peers by ID", i, tenant)
+			}
+		}
+		for _, target := range rule.Targets {
+			if _, _, err := parseTargetPattern(target); err != nil {
+				return fmt.Errorf("tunnel rule %d: %w", i, err)
+			}
+		}
+		for _, port := range rule.ListenPorts {
+			if port <= 0 || port > 65535 {
+				return fmt.Errorf("tunnel rule %d: invalid listen port %d", i, port)
+			}
+		}
+	}
+	return nil
+}
+
+// allowTarget reports whether a peer may reach host:port. peerID is empty
+// if the transport did not identify the peer.
+func (p *TunnelPolicy) allowTarget(peerID, host string, port int) bool {
+	for _, rule := range p.Rules {
+		if !rule.selects(peerID) {
+			continue
+		}
+		for _, target := range rule.Targets {
+			if matchTarget(target, host, port) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowListen reports whether a peer may bind port with a reverse tunnel
+func (p *TunnelPolicy) allowListen(peerID string, port int) bool {
+	for _, rule := range p.Rules {
+		if !rule.selects(peerID) {
+			continue
+		}
+		for _, allowed := range rule.ListenPorts {
+			if allowed == port {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selects reports whether the rule applies to the peer. Named peers never
+// match an unidentified one.
+func (r *TunnelRule) selects(peerID string) bool {
+	for _, id := range r.PeerIDs {
+		if id == "*" || (peerID != "" && id == peerID) {
+			return true
+		}
+	}
+	return slices.Contains(r.Tenants, "*")
+}
+
+// parseTargetPattern splits a host:port pattern and checks both parts
+func parseTargetPattern(pattern string) (string, string, error) {
+	host, port, err := net.SplitHostPort(pattern)
+	if err != nil || host == "" {
+		return "", "", fmt.Errorf("invalid target pattern %q", pattern)
+	}
+
+	if strings.Contains(host, "/") {
+		if _, _, err := net.ParseCIDR(host); err != nil {
+			return "", "", fmt.Errorf("invalid target pattern %q: %w", pattern, err)
+		}
+	}
+
+	if port != "*" {
+		if _, _, err := parsePortRange(port); err != nil {
+			return "", "", fmt.Errorf("invalid target pattern %q: %w", pattern, err)
+		}
+	}
+
+	return host, port, nil
+}
+
+// parsePortRange parses "N" or "N-M"
+func parsePortRange(s string) (int, int, error) {
+	lo, hi, isRange := strings.Cut(s, "-")
+	if !isRange {
+		hi = lo
+	}
+
+	low, err := strconv.Atoi(lo)
+	if err != nil || low <= 0 || low > 65535 {
+		return 0, 0, fmt.Errorf("invalid port %q", s)
+	}
+	high, err := strconv.Atoi(hi)
+	if err != nil || high < low || high > 65535 {
+		return 0, 0, fmt.Errorf("invalid port %q", s)
+	}
+
+	return low, high, nil
+}
+
+// matchTarget reports whether host:port matches a target pattern
+func matchTarget(pattern, host string, port int) bool {
+	patternHost, patternPort, err := parseTargetPattern(pattern)
+	if err != nil {
+		return false
+	}
+
+	if patternPort != "*" {
+		low, high, _ := parsePortRange(patternPort)
+		if port < low || port > high {
+			return false
+		}
+	}
+
+	switch {
+	case patternHost == "*":
+		return true
+	case patternHost == "localhost":
+		return isLocalHost(host)
+	case strings.Contains(patternHost, "/"):
+		_, block, _ := net.ParseCIDR(patternHost)
+		ip := net.ParseIP(host)
+		return ip != nil && block.Contains(ip)
+	}
+
+	if ip := net.ParseIP(patternHost); ip != nil {
+		return ip.Equal(net.ParseIP(host))
+	}
+	return strings.EqualFold(patternHost, host)
+}
+
+// checkTunnelTarget rejects the handshake unless peerID, the peer that sent
+// req, may reach its target. It returns false if the stream was rejected.
+func (c *Client) checkTunnelTarget(stream io.Writer, req handshakeRequest, peerID string) bool {
+	host, portStr, err := net.SplitHostPort(req.Target)
+	port, portErr := strconv.Atoi(portStr)
+	if err != nil || portErr != nil || port <= 0 || port > 65535 {
+		rejectHandshake(stream, HandshakeBadRequest, fmt.Sprintf("invalid target %q", req.Target))
+		return false
+	}
+
+	policy := c.config.TunnelPolicy
+	if policy == nil {
+		if c.config.DenyTunnelsByDefault {
+			fmt.Printf("denied peer %q access to %s: no tunnel policy\n", peerID, req.Target)
+			rejectHandshake(stream, HandshakeForbidden, "no tunnel policy")
+			return false
+		}
+		if !isLocalHost(host) {
+			rejectHandshake(stream, HandshakeForbidden, fmt.Sprintf("target %s is not a local address", req.Target))
+			return false
+		}
+		return true
+	}
+
+	if !policy.allowTarget(peerID, host, port) {
+		fmt.Printf("tunnel policy denied peer %q access to %s\n", peerID, req.Target)
+		rejectHandshake(stream, HandshakeForbidden, "target not allowed by tunnel policy")
+		return false
+	}
+	return true
+}
+
+// checkListenPort rejects the handshake unless peerID may bind port with a
+// reverse tunnel. Reverse tunnels are opt-in: without a policy, no port may
+// be bound. It returns false if the stream was rejected.
+func (c *Client) checkListenPort(stream io.Writer, peerID string, port int) bool {
+	policy := c.config.TunnelPolicy
+	if policy == nil {
+		fmt.Printf("denied peer %q listening on port %d: no tunnel policy\n", peerID, port)
+		rejectHandshake(stream, HandshakeForbidden, "reverse tunnels not enabled")
+		return false
+	}
+
+	if !policy.allowListen(peerID, port) {
+		fmt.Printf("tunnel policy denied peer %q listening on port %d\n", peerID, port)
+		rejectHandshake(stream, HandshakeForbidden, "listen port not allowed by tunnel policy")
+		return false
+	}
+	return true
+}
+
+// listenHost returns the address reverse tunnels bind their ports on
+func (c *Client) listenHost() string {
+	if policy := c.config.TunnelPolicy; policy != nil && policy.ListenHost != "" {
+		return policy.ListenHost
+	}
+	return "127.0.0.1"
+}
@@ -0,0 +1,307 @@
+package cloudbridge
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTunnelPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  TunnelPolicy
+		wantErr bool
+	}{
+		{
+			name:    "empty policy",
+			policy:  TunnelPolicy{},
+			wantErr: false,
+		},
+		{
+			name: "valid rules",
+			policy: TunnelPolicy{Rules: []TunnelRule{
+				{PeerIDs: []string{"peer-123"}, Targets: []string{"localhost:5432", "10.0.0.0/8:8000-8999"}},
+				{Tenants: []string{"*"}, Targets: []string{"*:*"}, ListenPorts: []int{8080}},
+			}},
+			wantErr: false,
+		},
+		{
+			name:    "named tenant",
+			policy:  TunnelPolicy{Rules: []TunnelRule{{Tenants: []string{"acme"}, Targets: []string{"*:*"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "rule without peers",
+			policy:  TunnelPolicy{Rules: []TunnelRule{{Targets: []string{"localhost:80"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "target without port",
+			policy:  TunnelPolicy{Rules: []TunnelRule{{PeerIDs: []string{"*"}, Targets: []string{"localhost"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid CIDR",
+			policy:  TunnelPolicy{Rules: []TunnelRule{{PeerIDs: []string{"*"}, Targets: []string{"10.0.0.0/33:80"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "inverted port range",
+			policy:  TunnelPolicy{Rules: []TunnelRule{{PeerIDs: []string{"*"}, Targets: []string{"localhost:90-80"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid listen host",
+			policy:  TunnelPolicy{ListenHost: "localhost"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid listen port",
+			policy:  TunnelPolicy{Rules: []TunnelRule{{PeerIDs: []string{"*"}, ListenPorts: []int{0}}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchTarget(t *testing.T) {
+	tests := []struct {
+		pattern string
+		host    string
+		port    int
+		want    bool
+	}{
+		{"localhost:5432", "localhost", 5432, true},
+		{"localhost:5432", "127.0.0.1", 5432, true},
+		{"localhost:5432", "::1", 5432, true},
+		{"localhost:5432", "localhost", 5433, false},
+		{"localhost:5432", "10.0.0.5", 5432, false},
+		{"localhost:*", "127.0.0.1", 22, true},
+		{"localhost:8000-8999", "localhost", 8080, true},
+		{"localhost:8000-8999", "localhost", 9000, false},
+		{"10.0.0.0/8:5432", "10.0.0.5", 5432, true},
+		{"10.0.0.0/8:5432", "192.168.1.5", 5432, false},
+		{"10.0.0.0/8:5432", "db.internal", 5432, false},
+		{"10.0.0.5:5432", "10.0.0.5", 5432, true},
+		{"db.internal:5432", "DB.internal", 5432, true},
+		{"db.internal:5432", "10.0.0.5", 5432, false},
+		{"*:443", "example.com", 443, true},
+		{"*:443", "example.com", 80, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%s:%d", tt.pattern, tt.host, tt.port), func(t *testing.T) {
+			if got := matchTarget(tt.pattern, tt.host, tt.port); got != tt.want {
+				t.Errorf("matchTarget() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTunnelPolicyNamesPeers(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []TunnelRule
+		want  bool
+	}{
+		{"no rules", nil, false},
+		{"any peer", []TunnelRule{{PeerIDs: []string{"*"}}}, false},
+		{"any tenant", []TunnelRule{{Tenants: []string{"*"}}}, false},
+		{"named peer", []TunnelRule{{PeerIDs: []string{"*"}}, {PeerIDs: []string{"peer-123"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &TunnelPolicy{Rules: tt.rules}
+			if got := policy.namesPeers(); got != tt.want {
+				t.Errorf("namesPeers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTunnelPolicyNamedPeersOverRelay(t *testing.T) {
+	policy := TunnelPolicy{Rules: []TunnelRule{
+		{PeerIDs: []string{"peer-123"}, Targets: []string{"localhost:5432"}},
+	}}
+
+	// The relay transport cannot identify peers to match the rule against
+	if _, err := NewClient(WithToken("test-token"), WithTunnelPolicy(policy)); err == nil {
+		t.Error("NewClient() with named peers over the relay error = nil, want error")
+	}
+
+	// Transports that identify peers accept it
+	newPipeClient(t, WithTunnelPolicy(policy))
+}
+
+func TestTunnelPolicyHandshake(t *testing.T) {
+	echoPort := startEchoServer(t)
+	echoTarget := fmt.Sprintf("127.0.0.1:%d", echoPort)
+
+	policy := TunnelPolicy{Rules: []TunnelRule{
+		{PeerIDs: []string{"peer-123"}, Targets: []string{fmt.Sprintf("localhost:%d", echoPort)}},
+	}}
+	anyPeer := TunnelPolicy{Rules: []TunnelRule{
+		{Tenants: []string{"*"}, Targets: []string{"localhost:*"}},
+	}}
+
+	tests := []struct {
+		name     string
+		policy   *TunnelPolicy
+		deny     bool   // WithDenyTunnelsByDefault
+		peer     string // as identified by the transport
+		req      handshakeRequest
+		wantCode HandshakeCode
+	}{
+		{
+			name:   "allowed peer",
+			policy: &policy,
+			peer:   "peer-123",
+			req: handshakeRequest{Kind: StreamKindTunnel, Target: echoTarget,
+				Metadata: map[string]string{metaPeerID: "peer-123"}},
+			wantCode: HandshakeOK,
+		},
+		{
+			name:     "allowed peer without claim",
+			policy:   &policy,
+			peer:     "peer-123",
+			req:      handshakeRequest{Kind: StreamKindTunnel, Target: echoTarget},
+			wantCode: HandshakeOK,
+		},
+		{
+			name:   "spoofed peer ID",
+			policy: &policy,
+			peer:   "peer-456",
+			req: handshakeRequest{Kind: StreamKindTunnel, Target: echoTarget,
+				Metadata: map[string]string{metaPeerID: "peer-123"}},
+			wantCode: HandshakeUnauthorized,
+		},
+		{
+			name:   "unidentified peer",
+			policy: &policy,
+			req: handshakeRequest{Kind: StreamKindTunnel, Target: echoTarget,
+				Metadata: map[string]string{metaPeerID: "peer-123"}},
+			wantCode: HandshakeForbidden,
+		},
+		{
+			name:     "unidentified peer with wildcard rule",
+			policy:   &anyPeer,
+			req:      handshakeRequest{Kind: StreamKindTunnel, Target: echoTarget},
+			wantCode: HandshakeOK,
+		},
+		{
+			name:   "unknown peer",
+			policy: &policy,
+			peer:   "peer-456",
+			req: handshakeRequest{Kind: StreamKindTunnel, Target: echoTarget,
+				Metadata: map[string]string{metaPeerID: "peer-456", metaTenantID: "acme"}},
+			wantCode: HandshakeForbidden,
+		},
+		{
+			name:   "target outside rule",
+			policy: &policy,
+			peer:   "peer-123",
+			req: handshakeRequest{Kind: StreamKindTunnel, Target: "127.0.0.1:22",
+				Metadata: map[string]string{metaPeerID: "peer-123"}},
+			wantCode: HandshakeForbidden,
+		},
+		{
+			name:   "UDP target outside rule",
+			policy: &policy,
+			peer:   "peer-123",
+			req: handshakeRequest{Kind: StreamKindUDP, Target: "127.0.0.1:53",
+				Metadata: map[string]string{metaPeerID: "peer-123"}},
+			wantCode: HandshakeForbidden,
+		},
+		{
+			name:   "reverse listen not allowed",
+			policy: &policy,
+			peer:   "peer-123",
+			req: handshakeRequest{Kind: StreamKindReverse, Target: ":8080",
+				Metadata: map[string]string{metaPeerID: "peer-123"}},
+			wantCode: HandshakeForbidden,
+		},
+		{
+			name:     "no policy",
+			peer:     "peer-123",
+			req:      handshakeRequest{Kind: StreamKindTunnel, Target: echoTarget},
+			wantCode: HandshakeOK,
+		},
+		{
+			name:     "no policy, denied by default",
+			deny:     true,
+			peer:     "peer-123",
+			req:      handshakeRequest{Kind: StreamKindTunnel, Target: echoTarget},
+			wantCode: HandshakeForbidden,
+		},
+		{
+			name:   "default deny",
+			policy: &TunnelPolicy{},
+			peer:   "peer-123",
+			req: handshakeRequest{Kind: StreamKindTunnel, Target: echoTarget,
+				Metadata: map[string]string{metaPeerID: "peer-123"}},
+			wantCode: HandshakeForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			if tt.policy != nil {
+				opts = append(opts, WithTunnelPolicy(*tt.policy))
+			}
+			if tt.deny {
+				opts = append(opts, WithDenyTunnelsByDefault())
+			}
+			server, _ := newPipeClient(t, opts...)
+
+			local, remote := net.Pipe()
+			defer local.Close()
+			server.handleStream(remote, tt.peer)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err := handshake(ctx, local, tt.req)
+			if tt.wantCode == HandshakeOK {
+				if err != nil {
+					t.Errorf("handshake() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var hsErr *HandshakeError
+			if !errors.As(err, &hsErr) || hsErr.Code != tt.wantCode {
+				t.Errorf("handshake() error = %v, want code %v", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestHandshakeMetadataTenant(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1","tenant_id":"acme"}`))
+	client, _ := newPipeClient(t, WithToken("header."+payload+".signature"))
+
+	metadata := client.handshakeMetadata()
+	if metadata[metaPeerID] != "local-peer" || metadata[metaTenantID] != "acme" {
+		t.Errorf("handshakeMetadata() = %v, want peer local-peer and tenant acme", metadata)
+	}
+
+	// Tokens without a tenant claim send no tenant
+	client, _ = newPipeClient(t)
+	if tenant, ok := client.handshakeMetadata()[metaTenantID]; ok {
+		t.Errorf("handshakeMetadata() tenant = %q, want none", tenant)
+	}
+}
@@ -0,0 +1,152 @@
+package cloudbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Handle registers handler for incoming streams opened with ConnectProtocol
+// for protocolID. Handlers run once Serve is active; each call gets its own
+// connection, which the handler owns and must close.
+// Registering a nil handler removes the protocol. A listener returned by
+// Listen for the protocol is closed.
+func (c *Client) Handle(protocolID string, handler func(conn Connection)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for l := range c.listeners {
+		if l.protocolID == protocolID {
+			delete(c.listeners, l)
+			l.shutdown()
+		}
+	}
+
+	if handler == nil {
+		delete(c.handlers, protocolID)
+		return
+	}
+	c.handlers[protocolID] = handler
+}
+
+// ConnectProtocol opens a connection to the handler for protocolID on the
+// specified peer. The handshake fails with a *HandshakeError if the peer has
+// no handler for the protocol. The connection does not reconnect: a new
+// stream would reach a new handler invocation with none of its state.
+func (c *Client) ConnectProtocol(ctx context.Context, peerID, protocolID string) (Connection, error) {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return nil, errors.New("client is closed")
+	}
+	c.mu.RUnlock()
+
+	if peerID == "" {
+		return nil, errors.New("peer ID cannot be empty")
+	}
+
+	if protocolID == "" {
+		return nil, errors.New("protocol ID cannot be empty")
+	}
+
+	return c.connect(ctx, peerID, RetryPolicy{}, func(ctx context.Context) (Stream, error) {
+		return c.openHandshakeStream(ctx, peerID, StreamKindProtocol, protocolID)
+	})
+}
+
+// openHandshakeStream opens a transport stream and performs a handshake
+// for the given stream kind and target
+func (c *Client) openHandshakeStream(ctx context.Context, peerID string, kind StreamKind, target string) (Stream, error) {
+	stream, err := c.transport.ConnectToPeer(ctx, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = handshake(ctx, stream, handshakeRequest{
+		Kind:     kind,
+		Target:   target,
+		Metadata: c.handshakeMetadata(),
+	})
+	if err != nil {
+		stream.Close()
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// handshakeMetadata identifies this client to the accepting peer, which
+// cannot verify it
+func (c *Client) handshakeMetadata() map[string]string {
+	metadata := map[string]string{metaPeerID: c.transport.LocalPeerID()}
+	if c.tenantID != "" {
+		metadata[metaTenantID] = c.tenantID
+	}
+	return metadata
+}
+
+// serveProtocol hands an incoming protocol stream from remote to its
+// registered handler. It reports whether the handler took ownership of the
+// stream.
+func (c *Client) serveProtocol(stream io.ReadWriteCloser, req handshakeRequest, remote string) bool {
+	c.mu.RLock()
+	handler := c.handlers[req.Target]
+	var l *listener
+	for candidate := range c.listeners {
+		if candidate.protocolID == req.Target {
+			l = candidate
+		}
+	}
+	c.mu.RUnlock()
+
+	if handler == nil {
+		rejectHandshake(stream, HandshakeUnknownProtocol, req.Target)
+		return false
+	}
+
+	// Streams for a listener wait in its backlog
+	if l != nil && !l.reserve() {
+		rejectHandshake(stream, HandshakeBusy, fmt.Sprintf("%d streams waiting to be accepted", listenBacklog))
+		return false
+	}
+
+	if err := writeHandshakeResponse(stream, HandshakeOK, ""); err != nil {
+		if l != nil {
+			l.release()
+		}
+		fmt.Printf("failed to acknowledge protocol %s: %v\n", req.Target, err)
+		return false
+	}
+
+	handler(c.incomingConnection(stream, remote))
+	return true
+}
+
+// incomingConnection wraps an accepted stream in a Connection
+func (c *Client) incomingConnection(stream io.ReadWriteCloser, peerID string) *connection {
+	s, ok := stream.(Stream)
+	if !ok {
+		s = noDeadlineStream{stream}
+	}
+
+	return &connection{
+		peerID:      peerID,
+		localPeerID: c.transport.LocalPeerID(),
+		connected:   true,
+		connectedAt: time.Now(),
+		bridgeConn:  s,
+	}
+}
+
+// noDeadlineStream adapts a stream without deadline support to Stream
+type noDeadlineStream struct {
+	io.ReadWriteCloser
+}
+
+var errDeadlineUnsupported = errors.New("stream does not support deadlines")
+
+func (noDeadlineStream) SetDeadline(t time.Time) error      { return errDeadlineUnsupported }
+func (noDeadlineStream) SetReadDeadline(t time.Time) error  { return errDeadlineUnsupported }
+func (noDeadlineStream) SetWriteDeadline(t time.Time) error { return errDeadlineUnsupported }
@@ -0,0 +1,85 @@
+package cloudbridge_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+func TestConnectProtocol(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+
+	peers := make(chan string, 1)
+	bob.Handle("/echo/1.0", func(conn cloudbridge.Connection) {
+		defer conn.Close()
+		peers <- conn.PeerID()
+		io.Copy(conn, conn)
+	})
+	bob.Handle("/greet/1.0", func(conn cloudbridge.Connection) {
+		defer conn.Close()
+		conn.Write([]byte("hello"))
+	})
+	serve(t, network, bob, "bob")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	echo, err := alice.ConnectProtocol(ctx, "bob", "/echo/1.0")
+	if err != nil {
+		t.Fatalf("ConnectProtocol() error = %v", err)
+	}
+	defer echo.Close()
+	echo.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := echo.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	got := make([]byte, 4)
+	if _, err := io.ReadFull(echo, got); err != nil {
+		t.Fatalf("ReadFull() error = %v", err)
+	}
+	if string(got) != "ping" {
+		t.Errorf("echo = %q, want %q", got, "ping")
+	}
+	if peer := <-peers; peer != "alice" {
+		t.Errorf("handler PeerID() = %v, want alice", peer)
+	}
+
+	greet, err := alice.ConnectProtocol(ctx, "bob", "/greet/1.0")
+	if err != nil {
+		t.Fatalf("ConnectProtocol() error = %v", err)
+	}
+	defer greet.Close()
+
+	data, err := io.ReadAll(greet)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("greeting = %q, want %q", data, "hello")
+	}
+}
+
+func TestConnectProtocolUnknown(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+
+	bob.Handle("/echo/1.0", func(conn cloudbridge.Connection) { conn.Close() })
+	bob.Handle("/echo/1.0", nil)
+	serve(t, network, bob, "bob")
+
+	_, err := alice.ConnectProtocol(context.Background(), "bob", "/echo/1.0")
+
+	var hsErr *cloudbridge.HandshakeError
+	if !errors.As(err, &hsErr) || hsErr.Code != cloudbridge.HandshakeUnknownProtocol {
+		t.Errorf("ConnectProtocol() error = %v, want HandshakeUnknownProtocol", err)
+	}
+}
@@ -0,0 +1,35 @@
+package cloudbridge
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConnectProtocolNoReconnect(t *testing.T) {
+	client, tr := newPipeClient(t, WithRetryPolicy(fastRetry))
+
+	go func() {
+		remote := tr.remote(t, 0)
+		if _, err := readHandshake(remote); err == nil {
+			writeHandshakeResponse(remote, HandshakeOK, "")
+		}
+		remote.Close()
+	}()
+
+	conn, err := client.ConnectProtocol(context.Background(), "peer-123", "/echo/1.0")
+	if err != nil {
+		t.Fatalf("ConnectProtocol() error = %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("hello")); err == nil {
+		t.Error("Write() on broken stream error = nil, want error")
+	}
+
+	tr.mu.Lock()
+	opened := len(tr.accepted)
+	tr.mu.Unlock()
+	if opened != 1 {
+		t.Errorf("broken protocol stream triggered reconnection: %d streams opened, want 1", opened)
+	}
+}
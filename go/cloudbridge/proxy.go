@@ -0,0 +1,58 @@
+package cloudbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// proxyConfig holds the settings shared by the proxy servers
+type proxyConfig struct {
+	gatewayPeer string
+}
+
+// ProxyOption configures a proxy server
+type ProxyOption func(*proxyConfig)
+
+// WithGatewayPeer routes connections to hosts outside the .cb domain
+// through peerID, which dials them from its own network. The gateway's
+// TunnelPolicy decides which hosts are reachable. Without a gateway only
+// peer addresses can be reached.
+func WithGatewayPeer(peerID string) ProxyOption {
+	return func(c *proxyConfig) {
+		c.gatewayPeer = peerID
+	}
+}
+
+// newProxyConfig applies the proxy options
+func newProxyConfig(opts []ProxyOption) proxyConfig {
+	var config proxyConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// errNoGateway is returned for non-peer addresses when no gateway is set
+var errNoGateway = errors.New("no gateway peer configured")
+
+// dialProxy connects a proxied request to addr. Peer addresses
+// (<peer-id>.cb, <service>.<peer-id>.cb) are dialed directly; anything else
+// goes through the gateway peer.
+func (c *Client) dialProxy(ctx context.Context, config proxyConfig, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+
+	if strings.HasSuffix(strings.ToLower(host), peerDomain) {
+		return c.DialContext(ctx, "tcp", addr)
+	}
+
+	if config.gatewayPeer == "" {
+		return nil, fmt.Errorf("cannot reach %s: %w", addr, errNoGateway)
+	}
+	return c.dialTarget(ctx, config.gatewayPeer, addr)
+}
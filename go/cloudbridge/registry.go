@@ -0,0 +1,472 @@
+package cloudbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Service registrations are replicated with mesh messages. Every peer
+// broadcasts the full list of its services whenever it changes, and again
+// every third of the shortest TTL to renew the lease. Receivers keep each
+// service until its lease runs out or the next list from its peer drops it.
+// A new client asks the mesh for the current lists when it starts, and
+// drops the services of peers that leave the mesh.
+//
+// When the transport cannot identify the sender, a list is only taken for
+// a peer with none, and later ones may only renew its leases: changes show
+// up once the leases of the previous list run out.
+const (
+	defaultServiceTTL = 30 * time.Second
+
+	// maxServiceTTL bounds the leases peers may ask for, so that a forged
+	// list cannot hide a peer's real services for long
+	maxServiceTTL = 5 * defaultServiceTTL
+
+	// minServiceTTL keeps renewals, every third of the TTL, from flooding
+	// the mesh
+	minServiceTTL = time.Second
+
+	// serviceSweepInterval is how often expired leases and departed peers
+	// are looked for
+	serviceSweepInterval = time.Second
+
+	// registryMagic marks registry messages among other mesh messages
+	registryMagic = "CBSR"
+
+	// registryClockSkew is how far ahead of the local clock a sequence
+	// number may run. Sequences start at the sender's start time in
+	// nanoseconds, so anything further ahead is forged, and accepting it
+	// would shut out the peer's real lists.
+	registryClockSkew = time.Minute
+)
+
+// registryMessage announces the services registered on a peer
+type registryMessage struct {
+	Peer     string          `json:"peer"`
+	Tenant   string          `json:"tenant,omitempty"`
+	Seq      uint64          `json:"seq"` // orders the lists of one peer
+	Services []serviceRecord `json:"services"`
+	Sync     bool            `json:"sync,omitempty"` // asks receivers for their lists
+}
+
+// serviceRecord is a service with its lease
+type serviceRecord struct {
+	Service
+	TTL time.Duration `json:"ttl"`
+}
+
+// peerServices holds the services last announced by a peer
+type peerServices struct {
+	seq      uint64
+	services []Service
+	expires  []time.Time
+}
+
+// renew extends the leases of the held services that records list again
+func (ps *peerServices) renew(records []serviceRecord, now time.Time) {
+	for _, record := range records {
+		ttl := min(record.TTL, maxServiceTTL)
+		if ttl <= 0 {
+			continue
+		}
+		for i, s := range ps.services {
+			if s.ID == record.ID {
+				ps.expires[i] = now.Add(ttl)
+			}
+		}
+	}
+}
+
+// serviceRegistry holds the local registrations and those replicated from
+// other peers
+type serviceRegistry struct {
+	client   *Client
+	mu       sync.Mutex
+	local    map[string]serviceRecord  // by service ID
+	checks   map[string]*healthChecker // health checks of local services
+	remote   map[string]*peerServices  // by peer ID
+	members  map[string]bool           // mesh peers at the last sweep
+	watchers map[*serviceWatcher]struct{}
+	seq      uint64
+	refresh  *time.Timer // renews the leases while services are registered
+	done     chan struct{}
+	closed   bool
+}
+
+// newServiceRegistry creates an empty registry for c
+func newServiceRegistry(c *Client) *serviceRegistry {
+	return &serviceRegistry{
+		client:   c,
+		local:    make(map[string]serviceRecord),
+		checks:   make(map[string]*healthChecker),
+		remote:   make(map[string]*peerServices),
+		members:  make(map[string]bool),
+		watchers: make(map[*serviceWatcher]struct{}),
+		done:     make(chan struct{}),
+		// Lists from a restarted client supersede the ones before it
+		seq: uint64(time.Now().UnixNano()),
+	}
+}
+
+// register adds or replaces a local service and announces the change.
+// A service with a health check starts out unhealthy.
+func (r *serviceRegistry) register(ctx context.Context, record serviceRecord, check *HealthCheck) {
+	r.mu.Lock()
+	r.stopCheckLocked(record.ID)
+	record.Healthy = check == nil
+	r.local[record.ID] = record
+	if check != nil {
+		r.checks[record.ID] = r.startHealthCheck(record.ID, *check)
+	}
+	msg := r.messageLocked(true)
+	r.scheduleLocked()
+	r.notifyLocked()
+	r.mu.Unlock()
+
+	r.announce(ctx, msg)
+}
+
+// deregister removes a local service and announces the change
+func (r *serviceRegistry) deregister(ctx context.Context, serviceID string) error {
+	r.mu.Lock()
+	if _, ok := r.local[serviceID]; !ok {
+		r.mu.Unlock()
+		return fmt.Errorf("service not found: %s", serviceID)
+	}
+	delete(r.local, serviceID)
+	r.stopCheckLocked(serviceID)
+	msg := r.messageLocked(true)
+	r.scheduleLocked()
+	r.notifyLocked()
+	r.mu.Unlock()
+
+	r.announce(ctx, msg)
+	return nil
+}
+
+// stopCheckLocked stops the health check of a local service, if any
+func (r *serviceRegistry) stopCheckLocked(serviceID string) {
+	if h := r.checks[serviceID]; h != nil {
+		h.stop()
+		delete(r.checks, serviceID)
+	}
+}
+
+// lookup returns the live services matching q, local ones first, then
+// by peer and ID
+func (r *serviceRegistry) lookup(q DiscoverServicesQuery) []Service {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pruneLocked(time.Now()) {
+		r.notifyLocked()
+	}
+	return r.lookupLocked(q)
+}
+
+// lookupLocked returns copies of the services matching q without pruning
+func (r *serviceRegistry) lookupLocked(q DiscoverServicesQuery) []Service {
+	var local, remote []Service
+	for _, record := range r.local {
+		if q.matches(record.Service) {
+			local = append(local, record.Service.clone())
+		}
+	}
+	for _, ps := range r.remote {
+		for _, s := range ps.services {
+			if q.matches(s) {
+				remote = append(remote, s.clone())
+			}
+		}
+	}
+
+	sortServices(local)
+	sortServices(remote)
+	return append(local, remote...)
+}
+
+// pruneLocked drops remote services whose lease ran out before now and
+// reports whether any were dropped
+func (r *serviceRegistry) pruneLocked(now time.Time) bool {
+	pruned := false
+	for peerID, ps := range r.remote {
+		live := 0
+		for i, s := range ps.services {
+			if now.After(ps.expires[i]) {
+				continue
+			}
+			ps.services[live], ps.expires[live] = s, ps.expires[i]
+			live++
+		}
+		if live < len(ps.services) {
+			pruned = true
+		}
+		ps.services, ps.expires = ps.services[:live], ps.expires[:live]
+		if live == 0 {
+			delete(r.remote, peerID)
+		}
+	}
+	return pruned
+}
+
+// sweep drops expired leases and the services of peers that left the mesh
+// since the last sweep. Peers never reported by the transport are kept
+// until their leases run out.
+func (r *serviceRegistry) sweep() {
+	peers := r.client.transport.GetMeshPeers()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+
+	members := make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		members[peer] = true
+	}
+
+	changed := r.pruneLocked(time.Now())
+	for peer := range r.members {
+		if _, ok := r.remote[peer]; ok && !members[peer] {
+			fmt.Printf("peer %s left the mesh, dropping its services\n", peer)
+			delete(r.remote, peer)
+			changed = true
+		}
+	}
+	r.members = members
+
+	if changed {
+		r.notifyLocked()
+	}
+}
+
+// sweepLoop sweeps the registry until it is closed
+func (r *serviceRegistry) sweepLoop() {
+	ticker := time.NewTicker(serviceSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.sweep()
+		}
+	}
+}
+
+// sortServices orders services by peer and ID
+func sortServices(services []Service) {
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].PeerID != services[j].PeerID {
+			return services[i].PeerID < services[j].PeerID
+		}
+		return services[i].ID < services[j].ID
+	})
+}
+
+// handleMessage applies a registry message from a peer. peerID is empty if
+// the transport cannot identify the sender; such messages are only taken
+// for peers the transport reports in the mesh, since anyone could have
+// sent them, and cannot replace a list already held.
+func (r *serviceRegistry) handleMessage(peerID string, data []byte) {
+	payload, ok := bytes.CutPrefix(data, []byte(registryMagic))
+	if !ok {
+		return
+	}
+
+	var msg registryMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		fmt.Printf("invalid service registry message from %s: %v\n", peerID, err)
+		return
+	}
+
+	c := r.client
+	switch {
+	case msg.Peer == "" || msg.Peer == c.transport.LocalPeerID():
+		return
+	case peerID != "" && peerID != msg.Peer:
+		fmt.Printf("ignoring services announced by %s for %s\n", peerID, msg.Peer)
+		return
+	case peerID == "" && !slices.Contains(c.transport.GetMeshPeers(), msg.Peer):
+		fmt.Printf("ignoring services announced for %s, which is not in the mesh\n", msg.Peer)
+		return
+	case msg.Seq > uint64(time.Now().Add(registryClockSkew).UnixNano()):
+		fmt.Printf("ignoring services announced for %s with sequence %d ahead of the clock\n", msg.Peer, msg.Seq)
+		return
+	case msg.Tenant != "" && c.tenantID != "" && msg.Tenant != c.tenantID:
+		// Only peers of the same tenant share a registry
+		return
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	switch ps := r.remote[msg.Peer]; {
+	case ps == nil || (peerID != "" && msg.Seq >= ps.seq):
+		ps = &peerServices{seq: msg.Seq}
+		for _, record := range msg.Services {
+			ttl := min(record.TTL, maxServiceTTL)
+			if ttl <= 0 {
+				continue
+			}
+			record.PeerID = msg.Peer
+			ps.services = append(ps.services, record.Service)
+			ps.expires = append(ps.expires, now.Add(ttl))
+		}
+		r.remote[msg.Peer] = ps
+		r.notifyLocked()
+	case msg.Seq == ps.seq:
+		ps.renew(msg.Services, now)
+	}
+
+	var reply *registryMessage
+	if msg.Sync && len(r.local) > 0 {
+		reply = r.messageLocked(false)
+	}
+	r.mu.Unlock()
+
+	if reply != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+		defer cancel()
+		r.send(ctx, msg.Peer, reply)
+	}
+}
+
+// sync announces the local services and asks the mesh for theirs
+func (r *serviceRegistry) sync(ctx context.Context) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	msg := r.messageLocked(false)
+	r.mu.Unlock()
+
+	msg.Sync = true
+	r.announce(ctx, msg)
+}
+
+// close stops renewing the leases and withdraws the local services
+func (r *serviceRegistry) close(ctx context.Context) {
+	r.mu.Lock()
+	r.closed = true
+	close(r.done)
+	if r.refresh != nil {
+		r.refresh.Stop()
+		r.refresh = nil
+	}
+	registered := len(r.local) > 0
+	for id := range r.checks {
+		r.stopCheckLocked(id)
+	}
+	clear(r.local)
+	for w := range r.watchers {
+		w.finish()
+	}
+	clear(r.watchers)
+	msg := r.messageLocked(true)
+	r.mu.Unlock()
+
+	if registered {
+		r.announce(ctx, msg)
+	}
+}
+
+// renew re-announces the local services before their leases run out
+func (r *serviceRegistry) renew() {
+	r.mu.Lock()
+	if r.closed || len(r.local) == 0 {
+		r.mu.Unlock()
+		return
+	}
+	msg := r.messageLocked(false)
+	r.scheduleLocked()
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.client.config.Timeout)
+	defer cancel()
+	r.announce(ctx, msg)
+}
+
+// scheduleLocked arms the renewal timer for the shortest local TTL, or
+// stops it when nothing is registered
+func (r *serviceRegistry) scheduleLocked() {
+	if r.refresh != nil {
+		r.refresh.Stop()
+		r.refresh = nil
+	}
+	if r.closed || len(r.local) == 0 {
+		return
+	}
+
+	ttl := time.Duration(0)
+	for _, record := range r.local {
+		if ttl == 0 || record.TTL < ttl {
+			ttl = record.TTL
+		}
+	}
+	r.refresh = time.AfterFunc(max(ttl, minServiceTTL)/3, r.renew)
+}
+
+// messageLocked builds the announcement of the local services. Changes get
+// a new sequence number; renewals repeat the current one.
+func (r *serviceRegistry) messageLocked(changed bool) *registryMessage {
+	if changed {
+		r.seq++
+	}
+
+	msg := &registryMessage{
+		Peer:     r.client.transport.LocalPeerID(),
+		Tenant:   r.client.tenantID,
+		Seq:      r.seq,
+		Services: make([]serviceRecord, 0, len(r.local)),
+	}
+	for _, record := range r.local {
+		msg.Services = append(msg.Services, record)
+	}
+	return msg
+}
+
+// announce broadcasts msg to the mesh. Failures are logged; the next
+// renewal retries.
+func (r *serviceRegistry) announce(ctx context.Context, msg *registryMessage) {
+	data, err := encodeRegistryMessage(msg)
+	if err == nil {
+		err = r.client.transport.Broadcast(ctx, data)
+	}
+	if err != nil {
+		fmt.Printf("failed to announce services: %v\n", err)
+	}
+}
+
+// send sends msg to one peer
+func (r *serviceRegistry) send(ctx context.Context, peerID string, msg *registryMessage) {
+	data, err := encodeRegistryMessage(msg)
+	if err == nil {
+		err = r.client.transport.Send(ctx, peerID, data)
+	}
+	if err != nil {
+		fmt.Printf("failed to send services to %s: %v\n", peerID, err)
+	}
+}
+
+// encodeRegistryMessage encodes msg as a mesh message
+func encodeRegistryMessage(msg *registryMessage) ([]byte, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(registryMagic), payload...), nil
+}
@@ -0,0 +1,139 @@
+package cloudbridge_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+func TestRegisterServiceUsesLocalPeerID(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+
+	ctx := context.Background()
+	if err := alice.RegisterService(ctx, cloudbridge.ServiceConfig{Name: "api", Port: 8080}); err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+
+	services, err := alice.DiscoverServices(ctx, "api")
+	if err != nil {
+		t.Fatalf("DiscoverServices() error = %v", err)
+	}
+	if len(services) != 1 || services[0].PeerID != "alice" {
+		t.Errorf("DiscoverServices() = %+v, want one service on alice", services)
+	}
+}
+
+// discoverPeers returns the peers offering service name as seen by client
+func discoverPeers(t *testing.T, client *cloudbridge.Client, name string) []string {
+	t.Helper()
+
+	services, err := client.DiscoverServices(context.Background(), name)
+	if err != nil {
+		t.Fatalf("DiscoverServices() error = %v", err)
+	}
+
+	var peers []string
+	for _, s := range services {
+		peers = append(peers, s.PeerID)
+	}
+	return peers
+}
+
+func TestServiceRegistryReplication(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+	ctx := context.Background()
+
+	if err := alice.RegisterService(ctx, cloudbridge.ServiceConfig{Name: "api", Port: 8080, TTL: time.Second}); err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+	waitFor(t, "bob to discover alice's service", func() bool {
+		return fmt.Sprint(discoverPeers(t, bob, "api")) == "[alice]"
+	})
+
+	// A client started later asks the mesh for existing services
+	carol := newTestClient(t, network, "carol")
+	waitFor(t, "carol to discover alice's service", func() bool {
+		return fmt.Sprint(discoverPeers(t, carol, "api")) == "[alice]"
+	})
+
+	// The lease is renewed while alice runs
+	time.Sleep(2 * time.Second)
+	if peers := discoverPeers(t, bob, "api"); fmt.Sprint(peers) != "[alice]" {
+		t.Errorf("DiscoverServices() after TTL = %v, want lease renewed", peers)
+	}
+
+	if err := bob.RegisterService(ctx, cloudbridge.ServiceConfig{Name: "api", Port: 8080}); err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+	waitFor(t, "alice to discover both services", func() bool {
+		return fmt.Sprint(discoverPeers(t, alice, "api")) == "[alice bob]"
+	})
+
+	services, _ := bob.DiscoverServices(ctx, "api")
+	if err := bob.DeregisterService(ctx, services[0].ID); err != nil {
+		t.Fatalf("DeregisterService() error = %v", err)
+	}
+	waitFor(t, "alice to see bob's service removed", func() bool {
+		return fmt.Sprint(discoverPeers(t, alice, "api")) == "[alice]"
+	})
+
+	// Closing a client withdraws its services
+	alice.Close()
+	waitFor(t, "carol to see alice's service removed", func() bool {
+		return len(discoverPeers(t, carol, "api")) == 0
+	})
+}
+
+func TestQueryServicesReplication(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+	ctx := context.Background()
+
+	// Same name, region and port on both peers
+	for _, client := range []*cloudbridge.Client{alice, bob} {
+		err := client.RegisterService(ctx, cloudbridge.ServiceConfig{Name: "api", Port: 8080, Version: "1.0.0"})
+		if err != nil {
+			t.Fatalf("RegisterService() error = %v", err)
+		}
+	}
+	err := bob.RegisterService(ctx, cloudbridge.ServiceConfig{
+		Name:     "api",
+		Port:     9090,
+		Version:  "2.0.0",
+		Tags:     []string{"canary"},
+		Metadata: map[string]string{"track": "beta"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+
+	waitFor(t, "alice to discover bob's services", func() bool {
+		return len(discoverPeers(t, alice, "api")) == 3
+	})
+
+	services, _ := alice.DiscoverServices(ctx, "api")
+	if services[0].ID == services[1].ID {
+		t.Errorf("services on alice and bob share ID %s", services[0].ID)
+	}
+
+	services, err = alice.QueryServices(ctx, cloudbridge.DiscoverServicesQuery{
+		Name:     "api",
+		Version:  "2.0.0",
+		Tags:     []string{"canary"},
+		Metadata: map[string]string{"track": "beta"},
+	})
+	if err != nil {
+		t.Fatalf("QueryServices() error = %v", err)
+	}
+	if len(services) != 1 || services[0].PeerID != "bob" || services[0].Port != 9090 {
+		t.Errorf("QueryServices() = %+v, want bob's canary on port 9090", services)
+	}
+}
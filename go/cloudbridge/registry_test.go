@@ -0,0 +1,337 @@
+package cloudbridge
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// announcement encodes the services of peer as a registry message
+func announcement(t *testing.T, peer, tenant string, seq uint64, ttl time.Duration, names ...string) []byte {
+	t.Helper()
+
+	msg := &registryMessage{Peer: peer, Tenant: tenant, Seq: seq}
+	for _, name := range names {
+		msg.Services = append(msg.Services, serviceRecord{
+			Service: Service{ID: name + "-" + peer, Name: name, Port: 8080, Healthy: true},
+			TTL:     ttl,
+		})
+	}
+
+	data, err := encodeRegistryMessage(msg)
+	if err != nil {
+		t.Fatalf("encodeRegistryMessage() error = %v", err)
+	}
+	return data
+}
+
+func TestServiceRegistryHandleMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages [][]byte
+		from     string
+		want     []string // peer IDs of the discovered "api" services
+	}{
+		{
+			name:     "announcement",
+			messages: [][]byte{announcement(t, "peer-a", "", 1, time.Minute, "api")},
+			want:     []string{"peer-a"},
+		},
+		{
+			name: "newer list replaces older",
+			messages: [][]byte{
+				announcement(t, "peer-a", "", 1, time.Minute, "api"),
+				announcement(t, "peer-a", "", 2, time.Minute, "web"),
+			},
+			from: "peer-a",
+			want: nil,
+		},
+		{
+			name: "unverified sender cannot replace a list",
+			messages: [][]byte{
+				announcement(t, "peer-a", "", 1, time.Minute, "api"),
+				announcement(t, "peer-a", "", 2, time.Minute, "web"),
+			},
+			want: []string{"peer-a"},
+		},
+		{
+			name: "stale list ignored",
+			messages: [][]byte{
+				announcement(t, "peer-a", "", 2, time.Minute, "api"),
+				announcement(t, "peer-a", "", 1, time.Minute),
+			},
+			want: []string{"peer-a"},
+		},
+		{
+			name:     "expired lease",
+			messages: [][]byte{announcement(t, "peer-a", "", 1, -time.Second, "api")},
+			want:     nil,
+		},
+		{
+			name:     "other tenant",
+			messages: [][]byte{announcement(t, "peer-a", "other-tenant", 1, time.Minute, "api")},
+			want:     nil,
+		},
+		{
+			name:     "unverified sender for a peer outside the mesh",
+			messages: [][]byte{announcement(t, "peer-c", "", 1, time.Minute, "api")},
+			want:     nil,
+		},
+		{
+			name:     "sequence ahead of the clock",
+			messages: [][]byte{announcement(t, "peer-a", "", math.MaxUint64, time.Minute, "api")},
+			from:     "peer-a",
+			want:     nil,
+		},
+		{
+			name: "forged sequence does not shut out the peer",
+			messages: [][]byte{
+				announcement(t, "peer-a", "", math.MaxUint64, time.Minute),
+				announcement(t, "peer-a", "", 1, time.Minute, "api"),
+			},
+			want: []string{"peer-a"},
+		},
+		{
+			name:     "sender does not match peer",
+			messages: [][]byte{announcement(t, "peer-a", "", 1, time.Minute, "api")},
+			from:     "peer-b",
+			want:     nil,
+		},
+		{
+			name:     "own announcement",
+			messages: [][]byte{announcement(t, "local-peer", "", 1, time.Minute, "api")},
+			want:     nil,
+		},
+		{
+			name:     "not a registry message",
+			messages: [][]byte{[]byte("hello")},
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, tr := newPipeClient(t)
+			client.tenantID = "tenant-1"
+			tr.setPeers("peer-a", "peer-b")
+
+			for _, msg := range tt.messages {
+				client.registry.handleMessage(tt.from, msg)
+			}
+
+			services, err := client.DiscoverServices(context.Background(), "api")
+			if err != nil {
+				t.Fatalf("DiscoverServices() error = %v", err)
+			}
+			if len(services) != len(tt.want) {
+				t.Fatalf("DiscoverServices() = %+v, want services on %v", services, tt.want)
+			}
+			for i, s := range services {
+				if s.PeerID != tt.want[i] {
+					t.Errorf("services[%d].PeerID = %s, want %s", i, s.PeerID, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestServiceRegistryLeases(t *testing.T) {
+	client, tr := newPipeClient(t)
+	tr.setPeers("peer-a")
+	r := client.registry
+
+	// A forged list far ahead of the clock and with a huge lease
+	forged := uint64(time.Now().Add(registryClockSkew / 2).UnixNano())
+	r.handleMessage("", announcement(t, "peer-a", "", forged, 24*time.Hour, "api"))
+	r.handleMessage("", announcement(t, "peer-a", "", forged, -time.Second, "web"))
+
+	r.mu.Lock()
+	ps := r.remote["peer-a"]
+	if len(ps.services) != 1 {
+		t.Fatalf("services = %+v, want api only", ps.services)
+	}
+	if lease := time.Until(ps.expires[0]); lease > maxServiceTTL {
+		t.Errorf("lease = %v, want at most %v", lease, maxServiceTTL)
+	}
+	expires := ps.expires[0]
+	r.mu.Unlock()
+
+	// The same list renews the lease, but cannot add services
+	time.Sleep(10 * time.Millisecond)
+	r.handleMessage("", announcement(t, "peer-a", "", forged, time.Minute, "api", "web"))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(ps.services) != 1 || !ps.expires[0].Before(expires) {
+		t.Errorf("after renewal services = %+v, expires %v, want api with a one minute lease", ps.services, ps.expires)
+	}
+}
+
+func TestServiceRegistryLocalFirst(t *testing.T) {
+	client, _ := newPipeClient(t)
+	ctx := context.Background()
+
+	client.registry.handleMessage("peer-a", announcement(t, "peer-a", "", 1, time.Minute, "api"))
+	if err := client.RegisterService(ctx, ServiceConfig{Name: "api", Port: 9000}); err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+
+	services, _ := client.DiscoverServices(ctx, "api")
+	if len(services) != 2 || services[0].PeerID != "local-peer" || services[1].PeerID != "peer-a" {
+		t.Errorf("DiscoverServices() = %+v, want local service then peer-a", services)
+	}
+
+	if err := client.DeregisterService(ctx, services[0].ID); err != nil {
+		t.Fatalf("DeregisterService() error = %v", err)
+	}
+	if err := client.DeregisterService(ctx, services[1].ID); err == nil {
+		t.Error("DeregisterService() of a remote service error = nil, want not found")
+	}
+}
+
+func TestRegisterServiceCopiesConfig(t *testing.T) {
+	client, _ := newPipeClient(t)
+	ctx := context.Background()
+
+	tags := []string{"http"}
+	metadata := map[string]string{"team": "payments"}
+	err := client.RegisterService(ctx, ServiceConfig{Name: "api", Port: 8080, Tags: tags, Metadata: metadata})
+	if err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+
+	// Changing the caller's slices and maps leaves the registration alone
+	tags[0] = "grpc"
+	metadata["team"] = "billing"
+
+	services, _ := client.QueryServices(ctx, DiscoverServicesQuery{Tags: []string{"http"}})
+	if len(services) != 1 {
+		t.Fatalf("QueryServices() = %+v, want the service tagged http", services)
+	}
+	if services[0].Metadata["team"] != "payments" {
+		t.Errorf("Metadata = %v, want team payments", services[0].Metadata)
+	}
+}
+
+func TestQueryServicesReturnsCopies(t *testing.T) {
+	client, _ := newPipeClient(t)
+	ctx := context.Background()
+
+	err := client.RegisterService(ctx, ServiceConfig{Name: "api", Port: 8080, Tags: []string{"http"}})
+	if err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+	data, _ := encodeRegistryMessage(&registryMessage{
+		Peer: "peer-a",
+		Seq:  1,
+		Services: []serviceRecord{{
+			Service: Service{ID: "api-peer-a", Name: "api", Port: 8080, Tags: []string{"http"}, Metadata: map[string]string{"region": "eu"}},
+			TTL:     time.Minute,
+		}},
+	})
+	client.registry.handleMessage("peer-a", data)
+
+	// Changing the returned services leaves the registry alone
+	services, _ := client.DiscoverServices(ctx, "api")
+	for i := range services {
+		services[i].Tags = append(services[i].Tags[:0], "grpc")
+		services[i].Metadata["team"] = "billing"
+	}
+
+	services, _ = client.DiscoverServices(ctx, "api")
+	if len(services) != 2 {
+		t.Fatalf("DiscoverServices() = %+v, want 2 services", services)
+	}
+	for _, s := range services {
+		if slices.Contains(s.Tags, "grpc") || s.Metadata["team"] != "" {
+			t.Errorf("service on %s = %+v, changed through an earlier result", s.PeerID, s)
+		}
+	}
+}
+
+func TestQueryServices(t *testing.T) {
+	client, _ := newPipeClient(t, WithRegion("eu-central"))
+	ctx := context.Background()
+
+	err := client.RegisterService(ctx, ServiceConfig{
+		Name:     "api",
+		Port:     8080,
+		Tags:     []string{"http"},
+		Version:  "2.0.0",
+		Metadata: map[string]string{"team": "payments"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+	client.registry.handleMessage("peer-a", announcement(t, "peer-a", "", 1, time.Minute, "api"))
+
+	services, _ := client.QueryServices(ctx, DiscoverServicesQuery{Name: "api"})
+	if len(services) != 2 {
+		t.Fatalf("QueryServices() = %+v, want local and peer-a services", services)
+	}
+	local := services[0]
+	if local.ID != "api-local-peer-8080" || local.Version != "2.0.0" {
+		t.Errorf("local service = %+v, want ID api-local-peer-8080 and version 2.0.0", local)
+	}
+	if local.Metadata["region"] != "eu-central" || local.Metadata["team"] != "payments" {
+		t.Errorf("local service metadata = %v, want region and team", local.Metadata)
+	}
+
+	tests := []struct {
+		name  string
+		query DiscoverServicesQuery
+		want  []string // peer IDs
+	}{
+		{"by version", DiscoverServicesQuery{Name: "api", Version: "2.0.0"}, []string{"local-peer"}},
+		{"by metadata", DiscoverServicesQuery{Metadata: map[string]string{"team": "payments"}}, []string{"local-peer"}},
+		{"by region", DiscoverServicesQuery{Region: "eu-central"}, []string{"local-peer"}},
+		{"by tag", DiscoverServicesQuery{AnyTags: []string{"http"}}, []string{"local-peer"}},
+		{"all names", DiscoverServicesQuery{}, []string{"local-peer", "peer-a"}},
+		{"no match", DiscoverServicesQuery{Name: "web"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services, err := client.QueryServices(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("QueryServices() error = %v", err)
+			}
+			var peers []string
+			for _, s := range services {
+				peers = append(peers, s.PeerID)
+			}
+			if fmt.Sprint(peers) != fmt.Sprint(tt.want) {
+				t.Errorf("QueryServices() peers = %v, want %v", peers, tt.want)
+			}
+		})
+	}
+}
+
+// stalledBroadcastTransport is a pipeTransport whose broadcasts wait for
+// their context, like a relay that does not answer
+type stalledBroadcastTransport struct {
+	*pipeTransport
+}
+
+func (s stalledBroadcastTransport) Broadcast(ctx context.Context, data []byte) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestNewClientSyncsInBackground(t *testing.T) {
+	tr := stalledBroadcastTransport{&pipeTransport{peerID: "local-peer"}}
+
+	start := time.Now()
+	client, err := NewClient(WithToken("test-token"), WithTimeout(5*time.Second), WithTransport(tr))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("NewClient() took %v, want it not to wait for the registry sync", elapsed)
+	}
+}
@@ -1,6 +1,12 @@
 package cloudbridge
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
 
 // Service represents a discovered service
 type Service struct {
@@ -9,16 +15,107 @@ type Service struct {
 	Address  string
 	Port     int
 	Tags     []string
+	Version  string
 	Healthy  bool
 	PeerID   string
 	Metadata map[string]string
 }
 
+// clone returns a copy of s that shares no slices or maps with it
+func (s Service) clone() Service {
+	s.Tags = slices.Clone(s.Tags)
+	s.Metadata = maps.Clone(s.Metadata)
+	return s
+}
+
+// DiscoverOption filters the services returned by DiscoverServices
+type DiscoverOption func(*discoverConfig)
+
+// discoverConfig holds the discovery filters
+type discoverConfig struct {
+	healthyOnly bool
+}
+
+// WithHealthyOnly leaves out services that are failing their health check
+func WithHealthyOnly() DiscoverOption {
+	return func(c *discoverConfig) {
+		c.healthyOnly = true
+	}
+}
+
+// DiscoverServicesQuery selects services by their attributes. Empty fields
+// match every service.
+type DiscoverServicesQuery struct {
+	Name    string
+	Version string
+
+	// Tags must all be present; of AnyTags, at least one
+	Tags    []string
+	AnyTags []string
+
+	// Metadata selects services whose metadata has all of these values
+	Metadata map[string]string
+
+	// Region matches Metadata["region"]
+	Region string
+
+	HealthyOnly bool
+}
+
+// matches reports whether s satisfies the query
+func (q *DiscoverServicesQuery) matches(s Service) bool {
+	if q.Name != "" && s.Name != q.Name {
+		return false
+	}
+	if q.Version != "" && s.Version != q.Version {
+		return false
+	}
+	if q.Region != "" && s.Metadata["region"] != q.Region {
+		return false
+	}
+	if q.HealthyOnly && !s.Healthy {
+		return false
+	}
+
+	for _, tag := range q.Tags {
+		if !slices.Contains(s.Tags, tag) {
+			return false
+		}
+	}
+	if len(q.AnyTags) > 0 && !slices.ContainsFunc(q.AnyTags, func(tag string) bool {
+		return slices.Contains(s.Tags, tag)
+	}) {
+		return false
+	}
+
+	for k, v := range q.Metadata {
+		if value, ok := s.Metadata[k]; !ok || value != v {
+			return false
+		}
+	}
+
+	return true
+}
+
 // ServiceConfig holds configuration for service registration
 type ServiceConfig struct {
-	Name string
-	Port int
-	Tags []string
+	Name    string
+	Port    int
+	Tags    []string
+	Version string
+
+	// Metadata is published with the service. "region" defaults to the
+	// client region.
+	Metadata map[string]string
+
+	// TTL is how long peers keep the registration without hearing from
+	// this client; it is renewed while the client runs (default: 30s,
+	// from 1s to 150s)
+	TTL time.Duration
+
+	// HealthCheck, if set, is run by this client to keep Service.Healthy
+	// up to date on every peer
+	HealthCheck *HealthCheck
 }
 
 // validate checks if the service configuration is valid
@@ -31,5 +128,36 @@ func (sc *ServiceConfig) validate() error {
 		return errors.New("invalid port")
 	}
 
+	for k := range sc.Metadata {
+		if k == "" {
+			return errors.New("metadata keys cannot be empty")
+		}
+	}
+
+	if sc.TTL < 0 {
+		return errors.New("TTL cannot be negative")
+	}
+
+	if sc.TTL > 0 && sc.TTL < minServiceTTL {
+		return fmt.Errorf("TTL cannot be less than %v", minServiceTTL)
+	}
+
+	if sc.TTL > maxServiceTTL {
+		return fmt.Errorf("TTL cannot exceed %v", maxServiceTTL)
+	}
+
+	if sc.TTL == 0 {
+		sc.TTL = defaultServiceTTL
+	}
+
+	if sc.HealthCheck != nil {
+		// Fill in defaults on a copy of the caller's check
+		check := *sc.HealthCheck
+		if err := check.validate(); err != nil {
+			return err
+		}
+		sc.HealthCheck = &check
+	}
+
 	return nil
 }
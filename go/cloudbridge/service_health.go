@@ -0,0 +1,221 @@
+package cloudbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Health check defaults
+const (
+	defaultHealthInterval     = 10 * time.Second
+	defaultHealthTimeout      = 2 * time.Second
+	defaultHealthyThreshold   = 1
+	defaultUnhealthyThreshold = 3
+)
+
+// HealthCheck defines how the registering client checks a service.
+// Exactly one of TCP, HTTP and Func must be set. A checked service is
+// registered as unhealthy until it passes HealthyThreshold checks in a row.
+type HealthCheck struct {
+	// TCP is a host:port that must accept connections
+	TCP string
+
+	// HTTP is a URL that must answer a GET with ExpectedStatus
+	// (default: any 2xx status)
+	HTTP           string
+	ExpectedStatus int
+
+	// Func reports the service as unhealthy by returning an error
+	Func func(ctx context.Context) error
+
+	// Interval between checks (default: 10s) and Timeout of each check
+	// (default: 2s)
+	Interval time.Duration
+	Timeout  time.Duration
+
+	// Consecutive results needed to change state
+	// (defaults: 1 to become healthy, 3 to become unhealthy)
+	HealthyThreshold   int
+	UnhealthyThreshold int
+}
+
+// validate checks the health check and fills in defaults
+func (hc *HealthCheck) validate() error {
+	kinds := 0
+	for _, set := range []bool{hc.TCP != "", hc.HTTP != "", hc.Func != nil} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return errors.New("health check needs exactly one of TCP, HTTP or Func")
+	}
+
+	if hc.TCP != "" {
+		if _, _, err := net.SplitHostPort(hc.TCP); err != nil {
+			return fmt.Errorf("invalid TCP health check address: %w", err)
+		}
+	}
+
+	if hc.HTTP != "" {
+		if _, err := http.NewRequest(http.MethodGet, hc.HTTP, nil); err != nil {
+			return fmt.Errorf("invalid HTTP health check URL: %w", err)
+		}
+	}
+
+	if hc.ExpectedStatus != 0 && (hc.ExpectedStatus < 100 || hc.ExpectedStatus > 599) {
+		return errors.New("invalid expected status")
+	}
+
+	if hc.Interval < 0 || hc.Timeout < 0 || hc.HealthyThreshold < 0 || hc.UnhealthyThreshold < 0 {
+		return errors.New("health check interval, timeout and thresholds cannot be negative")
+	}
+
+	if hc.Interval == 0 {
+		hc.Interval = defaultHealthInterval
+	}
+	if hc.Timeout == 0 {
+		hc.Timeout = defaultHealthTimeout
+	}
+	if hc.HealthyThreshold == 0 {
+		hc.HealthyThreshold = defaultHealthyThreshold
+	}
+	if hc.UnhealthyThreshold == 0 {
+		hc.UnhealthyThreshold = defaultUnhealthyThreshold
+	}
+
+	return nil
+}
+
+// run performs one check
+func (hc *HealthCheck) run(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, hc.Timeout)
+	defer cancel()
+
+	switch {
+	case hc.TCP != "":
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", hc.TCP)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case hc.HTTP != "":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, hc.HTTP, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if hc.ExpectedStatus != 0 && resp.StatusCode != hc.ExpectedStatus {
+			return fmt.Errorf("status %d, want %d", resp.StatusCode, hc.ExpectedStatus)
+		}
+		if hc.ExpectedStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+			return fmt.Errorf("status %d, want 2xx", resp.StatusCode)
+		}
+		return nil
+
+	default:
+		return hc.Func(ctx)
+	}
+}
+
+// healthChecker runs the health check of one local service
+type healthChecker struct {
+	registry  *serviceRegistry
+	serviceID string
+	check     HealthCheck
+	cancel    context.CancelFunc
+}
+
+// startHealthCheck starts checking a local service until stop is called
+func (r *serviceRegistry) startHealthCheck(serviceID string, check HealthCheck) *healthChecker {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &healthChecker{
+		registry:  r,
+		serviceID: serviceID,
+		check:     check,
+		cancel:    cancel,
+	}
+	go h.run(ctx)
+	return h
+}
+
+// run checks the service every interval and publishes state changes
+func (h *healthChecker) run(ctx context.Context) {
+	healthy := false
+	passes, failures := 0, 0
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		err := h.check.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			passes, failures = passes+1, 0
+		} else {
+			passes, failures = 0, failures+1
+		}
+
+		switch {
+		case !healthy && passes >= h.check.HealthyThreshold:
+			healthy = true
+			h.registry.setHealth(h, true, nil)
+		case healthy && failures >= h.check.UnhealthyThreshold:
+			healthy = false
+			h.registry.setHealth(h, false, err)
+		}
+
+		timer.Reset(h.check.Interval)
+	}
+}
+
+// stop stops the checks
+func (h *healthChecker) stop() {
+	h.cancel()
+}
+
+// setHealth records a state change reported by h and announces it, unless
+// the service has since been deregistered or registered again
+func (r *serviceRegistry) setHealth(h *healthChecker, healthy bool, cause error) {
+	r.mu.Lock()
+	record, ok := r.local[h.serviceID]
+	if r.closed || !ok || r.checks[h.serviceID] != h {
+		r.mu.Unlock()
+		return
+	}
+	record.Healthy = healthy
+	r.local[h.serviceID] = record
+	msg := r.messageLocked(true)
+	r.notifyLocked()
+	r.mu.Unlock()
+
+	if healthy {
+		fmt.Printf("service %s is healthy\n", h.serviceID)
+	} else {
+		fmt.Printf("service %s is unhealthy: %v\n", h.serviceID, cause)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.client.config.Timeout)
+	defer cancel()
+	r.announce(ctx, msg)
+}
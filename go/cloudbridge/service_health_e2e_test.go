@@ -0,0 +1,64 @@
+package cloudbridge_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+func TestServiceHealthReplication(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+	ctx := context.Background()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	err = alice.RegisterService(ctx, cloudbridge.ServiceConfig{
+		Name: "api",
+		Port: 8080,
+		HealthCheck: &cloudbridge.HealthCheck{
+			TCP:                listener.Addr().String(),
+			Interval:           20 * time.Millisecond,
+			UnhealthyThreshold: 1,
+		},
+	})
+	if err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+
+	healthyPeers := func() string {
+		services, err := bob.DiscoverServices(ctx, "api", cloudbridge.WithHealthyOnly())
+		if err != nil {
+			t.Fatalf("DiscoverServices() error = %v", err)
+		}
+		var peers []string
+		for _, s := range services {
+			peers = append(peers, s.PeerID)
+		}
+		return fmt.Sprint(peers)
+	}
+
+	waitFor(t, "bob to see alice's service healthy", func() bool {
+		return healthyPeers() == "[alice]"
+	})
+
+	listener.Close()
+	waitFor(t, "bob to see alice's service unhealthy", func() bool {
+		return healthyPeers() == "[]"
+	})
+
+	// Unhealthy services are still discovered without the filter
+	if peers := discoverPeers(t, bob, "api"); fmt.Sprint(peers) != "[alice]" {
+		t.Errorf("DiscoverServices() = %v, want [alice]", peers)
+	}
+}
@@ -0,0 +1,121 @@
+package cloudbridge
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		check   HealthCheck
+		wantErr bool
+	}{
+		{name: "TCP open", check: HealthCheck{TCP: server.Listener.Addr().String()}, wantErr: false},
+		{name: "TCP closed", check: HealthCheck{TCP: closedAddr}, wantErr: true},
+		{name: "HTTP ok", check: HealthCheck{HTTP: server.URL + "/up"}, wantErr: false},
+		{name: "HTTP error status", check: HealthCheck{HTTP: server.URL + "/down"}, wantErr: true},
+		{name: "HTTP expected status", check: HealthCheck{HTTP: server.URL + "/down", ExpectedStatus: 503}, wantErr: false},
+		{name: "HTTP unexpected status", check: HealthCheck{HTTP: server.URL + "/up", ExpectedStatus: 204}, wantErr: true},
+		{name: "func ok", check: HealthCheck{Func: func(ctx context.Context) error { return nil }}, wantErr: false},
+		{name: "func error", check: HealthCheck{Func: func(ctx context.Context) error { return errors.New("down") }}, wantErr: true},
+		{
+			name: "func timeout",
+			check: HealthCheck{Timeout: 10 * time.Millisecond, Func: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.check.validate(); err != nil {
+				t.Fatalf("validate() error = %v", err)
+			}
+			err := tt.check.run(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceHealthTransitions(t *testing.T) {
+	client, _ := newPipeClient(t)
+	ctx := context.Background()
+
+	var up atomic.Bool
+	err := client.RegisterService(ctx, ServiceConfig{
+		Name: "api",
+		Port: 8080,
+		HealthCheck: &HealthCheck{
+			Func: func(ctx context.Context) error {
+				if !up.Load() {
+					return errors.New("down")
+				}
+				return nil
+			},
+			Interval:           10 * time.Millisecond,
+			UnhealthyThreshold: 2,
+		},
+	})
+	if err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+
+	healthy := func() int {
+		services, err := client.DiscoverServices(ctx, "api", WithHealthyOnly())
+		if err != nil {
+			t.Fatalf("DiscoverServices() error = %v", err)
+		}
+		return len(services)
+	}
+
+	// Checked services start out unhealthy
+	if all, _ := client.DiscoverServices(ctx, "api"); len(all) != 1 || all[0].Healthy {
+		t.Fatalf("DiscoverServices() = %+v, want one unhealthy service", all)
+	}
+	if n := healthy(); n != 0 {
+		t.Errorf("DiscoverServices(WithHealthyOnly) = %d services, want 0", n)
+	}
+
+	up.Store(true)
+	deadline := time.Now().Add(5 * time.Second)
+	for healthy() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("service did not become healthy")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	up.Store(false)
+	deadline = time.Now().Add(5 * time.Second)
+	for healthy() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("service did not become unhealthy")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
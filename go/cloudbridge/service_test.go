@@ -2,6 +2,7 @@ package cloudbridge
 
 import (
 	"testing"
+	"time"
 )
 
 func TestServiceConfigValidate(t *testing.T) {
@@ -76,6 +77,115 @@ func TestServiceConfigValidate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "TCP health check",
+			config: ServiceConfig{
+				Name:        "test-service",
+				Port:        8080,
+				HealthCheck: &HealthCheck{TCP: "localhost:8080"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "HTTP health check",
+			config: ServiceConfig{
+				Name:        "test-service",
+				Port:        8080,
+				HealthCheck: &HealthCheck{HTTP: "http://localhost:8080/healthz", ExpectedStatus: 204},
+			},
+			wantErr: false,
+		},
+		{
+			name: "health check without a kind",
+			config: ServiceConfig{
+				Name:        "test-service",
+				Port:        8080,
+				HealthCheck: &HealthCheck{Interval: time.Second},
+			},
+			wantErr: true,
+		},
+		{
+			name: "health check with two kinds",
+			config: ServiceConfig{
+				Name:        "test-service",
+				Port:        8080,
+				HealthCheck: &HealthCheck{TCP: "localhost:8080", HTTP: "http://localhost:8080/"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "TCP health check without port",
+			config: ServiceConfig{
+				Name:        "test-service",
+				Port:        8080,
+				HealthCheck: &HealthCheck{TCP: "localhost"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid expected status",
+			config: ServiceConfig{
+				Name:        "test-service",
+				Port:        8080,
+				HealthCheck: &HealthCheck{HTTP: "http://localhost:8080/", ExpectedStatus: 42},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative health check threshold",
+			config: ServiceConfig{
+				Name:        "test-service",
+				Port:        8080,
+				HealthCheck: &HealthCheck{TCP: "localhost:8080", UnhealthyThreshold: -1},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative TTL",
+			config: ServiceConfig{
+				Name: "test-service",
+				Port: 8080,
+				TTL:  -time.Second,
+			},
+			wantErr: true,
+		},
+		{
+			name: "TTL below the minimum",
+			config: ServiceConfig{
+				Name: "test-service",
+				Port: 8080,
+				TTL:  time.Nanosecond,
+			},
+			wantErr: true,
+		},
+		{
+			name: "TTL above the maximum",
+			config: ServiceConfig{
+				Name: "test-service",
+				Port: 8080,
+				TTL:  time.Hour,
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid metadata and version",
+			config: ServiceConfig{
+				Name:     "test-service",
+				Port:     8080,
+				Version:  "1.4.2",
+				Metadata: map[string]string{"team": "payments"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "empty metadata key",
+			config: ServiceConfig{
+				Name:     "test-service",
+				Port:     8080,
+				Metadata: map[string]string{"": "x"},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -125,3 +235,43 @@ func TestServiceStruct(t *testing.T) {
 	}
 }
 
+
+func TestDiscoverServicesQueryMatches(t *testing.T) {
+	service := Service{
+		Name:     "api",
+		Version:  "2.0.0",
+		Tags:     []string{"http", "public"},
+		Healthy:  true,
+		Metadata: map[string]string{"region": "eu-central", "team": "payments"},
+	}
+
+	tests := []struct {
+		name  string
+		query DiscoverServicesQuery
+		want  bool
+	}{
+		{"empty query", DiscoverServicesQuery{}, true},
+		{"name", DiscoverServicesQuery{Name: "api"}, true},
+		{"other name", DiscoverServicesQuery{Name: "web"}, false},
+		{"version", DiscoverServicesQuery{Version: "2.0.0"}, true},
+		{"other version", DiscoverServicesQuery{Version: "1.0.0"}, false},
+		{"all tags", DiscoverServicesQuery{Tags: []string{"http", "public"}}, true},
+		{"missing tag", DiscoverServicesQuery{Tags: []string{"http", "grpc"}}, false},
+		{"any tag", DiscoverServicesQuery{AnyTags: []string{"grpc", "public"}}, true},
+		{"no tag", DiscoverServicesQuery{AnyTags: []string{"grpc", "internal"}}, false},
+		{"metadata", DiscoverServicesQuery{Metadata: map[string]string{"team": "payments"}}, true},
+		{"other metadata value", DiscoverServicesQuery{Metadata: map[string]string{"team": "search"}}, false},
+		{"missing metadata key", DiscoverServicesQuery{Metadata: map[string]string{"tier": ""}}, false},
+		{"region", DiscoverServicesQuery{Region: "eu-central"}, true},
+		{"other region", DiscoverServicesQuery{Region: "us-east"}, false},
+		{"healthy only", DiscoverServicesQuery{HealthyOnly: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.query.matches(service); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
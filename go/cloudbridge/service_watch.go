@@ -0,0 +1,211 @@
+package cloudbridge
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ServiceEventType identifies a change to the services being watched
+type ServiceEventType string
+
+// Service event types
+const (
+	ServiceAdded   ServiceEventType = "added"
+	ServiceUpdated ServiceEventType = "updated" // e.g. a health transition
+	ServiceRemoved ServiceEventType = "removed"
+)
+
+// ServiceEvent reports a change to a watched service. Removed events carry
+// the service as it was last seen.
+type ServiceEvent struct {
+	Type    ServiceEventType
+	Service Service
+}
+
+// serviceWatcher forwards the changes to the services named name. Events
+// are queued so that a slow reader never holds up the registry, and a
+// pending event is merged with later ones for the same service so that the
+// queue never holds more than one event per service.
+type serviceWatcher struct {
+	query  DiscoverServicesQuery
+	known  map[string]Service // by peer and ID, guarded by the registry lock
+	events chan ServiceEvent
+
+	mu      sync.Mutex
+	queue   []string                // keys of the pending events, oldest first
+	pending map[string]ServiceEvent // by key
+	done    bool
+	wake    chan struct{}
+}
+
+// watch starts watching the services named name. The current services are
+// reported first as added.
+func (r *serviceRegistry) watch(ctx context.Context, name string) (<-chan ServiceEvent, error) {
+	w := &serviceWatcher{
+		query:   DiscoverServicesQuery{Name: name},
+		known:   make(map[string]Service),
+		events:  make(chan ServiceEvent),
+		pending: make(map[string]ServiceEvent),
+		wake:    make(chan struct{}, 1),
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, errors.New("client is closed")
+	}
+	if r.pruneLocked(time.Now()) {
+		r.notifyLocked()
+	}
+	r.watchers[w] = struct{}{}
+	w.update(r.lookupLocked(w.query))
+	r.mu.Unlock()
+
+	go w.run(ctx, r)
+	return w.events, nil
+}
+
+// unwatch stops sending changes to w
+func (r *serviceRegistry) unwatch(w *serviceWatcher) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.watchers, w)
+}
+
+// notifyLocked reports the current services to every watcher
+func (r *serviceRegistry) notifyLocked() {
+	for w := range r.watchers {
+		w.update(r.lookupLocked(w.query))
+	}
+}
+
+// update queues the differences between services and the services last
+// reported
+func (w *serviceWatcher) update(services []Service) {
+	var events []ServiceEvent
+
+	current := make(map[string]bool, len(services))
+	for _, s := range services {
+		key := s.PeerID + "/" + s.ID
+		current[key] = true
+
+		old, ok := w.known[key]
+		switch {
+		case !ok:
+			events = append(events, ServiceEvent{Type: ServiceAdded, Service: s})
+		case !reflect.DeepEqual(old, s):
+			events = append(events, ServiceEvent{Type: ServiceUpdated, Service: s})
+		default:
+			continue
+		}
+		w.known[key] = s.clone()
+	}
+
+	var removed []Service
+	for key, s := range w.known {
+		if !current[key] {
+			removed = append(removed, s)
+			delete(w.known, key)
+		}
+	}
+	sortServices(removed)
+	for _, s := range removed {
+		events = append(events, ServiceEvent{Type: ServiceRemoved, Service: s})
+	}
+
+	if len(events) > 0 {
+		w.push(events)
+	}
+}
+
+// push queues events for the reader
+func (w *serviceWatcher) push(events []ServiceEvent) {
+	w.mu.Lock()
+	for _, event := range events {
+		w.queueLocked(event)
+	}
+	w.mu.Unlock()
+	w.signal()
+}
+
+// queueLocked queues event, merging it with the event already pending for
+// the same service so that the reader only sees the net change
+func (w *serviceWatcher) queueLocked(event ServiceEvent) {
+	key := event.Service.PeerID + "/" + event.Service.ID
+	prev, ok := w.pending[key]
+	if !ok {
+		w.queue = append(w.queue, key)
+		w.pending[key] = event
+		return
+	}
+
+	switch {
+	case prev.Type == ServiceAdded && event.Type == ServiceRemoved:
+		// The reader never saw the service
+		delete(w.pending, key)
+		w.queue = slices.DeleteFunc(w.queue, func(k string) bool { return k == key })
+		return
+	case prev.Type == ServiceAdded:
+		event.Type = ServiceAdded
+	case prev.Type == ServiceRemoved && event.Type == ServiceAdded:
+		// The reader still has the service as it was before the removal
+		event.Type = ServiceUpdated
+	}
+	w.pending[key] = event
+}
+
+// finish closes the channel once the queued events are read
+func (w *serviceWatcher) finish() {
+	w.mu.Lock()
+	w.done = true
+	w.mu.Unlock()
+	w.signal()
+}
+
+// signal wakes run without blocking
+func (w *serviceWatcher) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers the queued events until ctx ends or the registry closes
+func (w *serviceWatcher) run(ctx context.Context, r *serviceRegistry) {
+	defer close(w.events)
+
+	for {
+		w.mu.Lock()
+		if len(w.queue) == 0 {
+			done := w.done
+			w.mu.Unlock()
+			if done {
+				return
+			}
+
+			select {
+			case <-w.wake:
+				continue
+			case <-ctx.Done():
+				r.unwatch(w)
+				return
+			}
+		}
+		key := w.queue[0]
+		w.queue = w.queue[1:]
+		event := w.pending[key]
+		delete(w.pending, key)
+		w.mu.Unlock()
+
+		select {
+		case w.events <- event:
+		case <-ctx.Done():
+			r.unwatch(w)
+			return
+		}
+	}
+}
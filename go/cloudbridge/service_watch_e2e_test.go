@@ -0,0 +1,51 @@
+package cloudbridge_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+func TestWatchServices(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	ctx := context.Background()
+
+	bobTransport := network.NewTransport("bob")
+	bob, err := cloudbridge.NewClient(cloudbridge.WithToken("test-token"), cloudbridge.WithTransport(bobTransport))
+	if err != nil {
+		t.Fatalf("Failed to create client bob: %v", err)
+	}
+	t.Cleanup(func() { bob.Close() })
+
+	events, err := alice.WatchServices(ctx, "api")
+	if err != nil {
+		t.Fatalf("WatchServices() error = %v", err)
+	}
+
+	next := func(want cloudbridge.ServiceEventType) {
+		t.Helper()
+		select {
+		case event := <-events:
+			if event.Type != want || event.Service.PeerID != "bob" {
+				t.Fatalf("event = %s on %s, want %s on bob", event.Type, event.Service.PeerID, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s event", want)
+		}
+	}
+
+	if err := bob.RegisterService(ctx, cloudbridge.ServiceConfig{Name: "api", Port: 8080}); err != nil {
+		t.Fatalf("RegisterService() error = %v", err)
+	}
+	next(cloudbridge.ServiceAdded)
+
+	// bob drops off the mesh without withdrawing its service. Give alice a
+	// membership sweep to see bob first.
+	time.Sleep(1500 * time.Millisecond)
+	bobTransport.Close()
+	next(cloudbridge.ServiceRemoved)
+}
@@ -0,0 +1,188 @@
+package cloudbridge
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// nextEvent returns the next event from events, failing the test if none
+// arrives in time
+func nextEvent(t *testing.T, events <-chan ServiceEvent) ServiceEvent {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("event channel closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a service event")
+	}
+	return ServiceEvent{}
+}
+
+func TestWatchServices(t *testing.T) {
+	client, _ := newPipeClient(t)
+	ctx := context.Background()
+
+	// Services registered before the watch are reported first
+	client.registry.handleMessage("peer-a", announcement(t, "peer-a", "", 1, time.Minute, "api"))
+
+	events, err := client.WatchServices(ctx, "api")
+	if err != nil {
+		t.Fatalf("WatchServices() error = %v", err)
+	}
+
+	steps := []struct {
+		name     string
+		change   func()
+		wantType ServiceEventType
+		wantPeer string
+	}{
+		{
+			name:     "initial snapshot",
+			change:   func() {},
+			wantType: ServiceAdded,
+			wantPeer: "peer-a",
+		},
+		{
+			name: "local registration",
+			change: func() {
+				client.RegisterService(ctx, ServiceConfig{Name: "api", Port: 9000})
+			},
+			wantType: ServiceAdded,
+			wantPeer: "local-peer",
+		},
+		{
+			name: "remote update",
+			change: func() {
+				data, _ := encodeRegistryMessage(&registryMessage{
+					Peer: "peer-a",
+					Seq:  2,
+					Services: []serviceRecord{{
+						Service: Service{ID: "api-peer-a", Name: "api", Port: 8080, Healthy: false},
+						TTL:     time.Minute,
+					}},
+				})
+				client.registry.handleMessage("peer-a", data)
+			},
+			wantType: ServiceUpdated,
+			wantPeer: "peer-a",
+		},
+		{
+			name: "other service ignored, then remote removal",
+			change: func() {
+				client.RegisterService(ctx, ServiceConfig{Name: "web", Port: 9001})
+				client.registry.handleMessage("peer-a", announcement(t, "peer-a", "", 3, time.Minute))
+			},
+			wantType: ServiceRemoved,
+			wantPeer: "peer-a",
+		},
+		{
+			name: "lease expiry",
+			change: func() {
+				client.registry.handleMessage("peer-b", announcement(t, "peer-b", "", 1, 50*time.Millisecond, "api"))
+				if event := nextEvent(t, events); event.Type != ServiceAdded {
+					t.Fatalf("event = %+v, want peer-b added", event)
+				}
+			},
+			wantType: ServiceRemoved,
+			wantPeer: "peer-b",
+		},
+		{
+			name: "local deregistration",
+			change: func() {
+				services, _ := client.DiscoverServices(ctx, "api")
+				client.DeregisterService(ctx, services[0].ID)
+			},
+			wantType: ServiceRemoved,
+			wantPeer: "local-peer",
+		},
+	}
+
+	for _, step := range steps {
+		step.change()
+		event := nextEvent(t, events)
+		if event.Type != step.wantType || event.Service.PeerID != step.wantPeer {
+			t.Errorf("%s: event = %s on %s, want %s on %s",
+				step.name, event.Type, event.Service.PeerID, step.wantType, step.wantPeer)
+		}
+	}
+
+	client.Close()
+	if _, ok := <-events; ok {
+		t.Error("event channel still open after Close()")
+	}
+}
+
+func TestWatchServicesCancel(t *testing.T) {
+	client, _ := newPipeClient(t)
+
+	if _, err := client.WatchServices(context.Background(), ""); err == nil {
+		t.Error("WatchServices() with empty name error = nil, want error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := client.WatchServices(ctx, "api")
+	if err != nil {
+		t.Fatalf("WatchServices() error = %v", err)
+	}
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("unexpected event after cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event channel not closed after cancel")
+	}
+
+	client.registry.mu.Lock()
+	watchers := len(client.registry.watchers)
+	client.registry.mu.Unlock()
+	if watchers != 0 {
+		t.Errorf("watchers = %d after cancel, want 0", watchers)
+	}
+}
+
+func TestServiceWatcherMergesPendingEvents(t *testing.T) {
+	w := &serviceWatcher{
+		known:   make(map[string]Service),
+		pending: make(map[string]ServiceEvent),
+		wake:    make(chan struct{}, 1),
+	}
+	a := Service{ID: "api-peer-a", Name: "api", PeerID: "peer-a", Healthy: true}
+	b := Service{ID: "api-peer-b", Name: "api", PeerID: "peer-b", Healthy: true}
+	c := Service{ID: "api-peer-c", Name: "api", PeerID: "peer-c", Healthy: true}
+
+	// Nothing is read, as with a reader that has fallen behind
+	w.update([]Service{a})
+	w.queue, w.pending = nil, make(map[string]ServiceEvent)
+	for i := 0; i < 100; i++ {
+		unhealthy := b
+		unhealthy.Healthy = false
+		w.update([]Service{b, c})
+		w.update([]Service{unhealthy})
+	}
+	w.update([]Service{b})
+
+	if len(w.queue) != 2 {
+		t.Fatalf("queued events = %d, want one per changed service", len(w.queue))
+	}
+	want := map[string]ServiceEventType{
+		"peer-a/api-peer-a": ServiceRemoved, // seen, then removed
+		"peer-b/api-peer-b": ServiceAdded,   // never seen, ends healthy
+	}
+	for _, key := range w.queue {
+		event := w.pending[key]
+		if event.Type != want[key] {
+			t.Errorf("%s event = %s, want %s", key, event.Type, want[key])
+		}
+		if key == "peer-b/api-peer-b" && !event.Service.Healthy {
+			t.Errorf("%s event reports the service unhealthy, want its latest state", key)
+		}
+	}
+}
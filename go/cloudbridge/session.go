@@ -0,0 +1,471 @@
+package cloudbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/yamux"
+)
+
+// Session is a multiplexed connection to a peer.
+// All streams of a session share a single transport stream, so opening a
+// stream costs no new peer connection. Sessions are multiplexed with yamux
+// rather than mapped onto transport streams, because a Transport only offers
+// one byte stream per ConnectToPeer.
+type Session interface {
+	// ID returns the session identifier, unique within a Client
+	ID() string
+
+	// PeerID returns the remote peer identifier
+	PeerID() string
+
+	// OpenStream opens a new logical stream to the peer, which receives
+	// it from AcceptStream on its end of the session
+	OpenStream(ctx context.Context) (Connection, error)
+
+	// AcceptStream waits for the peer to open a stream with OpenStream
+	AcceptStream(ctx context.Context) (Connection, error)
+
+	// NumStreams returns the number of open streams
+	NumStreams() int
+
+	// IsClosed reports whether the session has been closed
+	IsClosed() bool
+
+	// Close closes the session and all of its streams
+	Close() error
+}
+
+// session implements the Session interface on top of yamux
+type session struct {
+	id          string
+	peerID      string
+	localPeerID string
+	client      *Client
+	mux         *yamux.Session
+	dialed      bool
+	mu          sync.Mutex
+	closed      bool
+
+	// Streams the peer opened with OpenStream, waiting for AcceptStream.
+	// They are nil for sessions the SDK uses internally, which refuse
+	// such streams. slots reserves room in streams before a stream is
+	// acknowledged.
+	streams chan *connection
+	slots   chan struct{}
+}
+
+// streamBacklog is the number of streams a session queues for AcceptStream,
+// and sessionBacklog the number of sessions a client queues for
+// AcceptSession. Further ones are rejected with HandshakeBusy.
+const (
+	streamBacklog  = 64
+	sessionBacklog = 16
+)
+
+// Dial opens a multiplexed session to the specified peer.
+// The peer receives it from AcceptSession; Serve must be running there.
+func (c *Client) Dial(ctx context.Context, peerID string) (Session, error) {
+	return c.dial(ctx, peerID, true)
+}
+
+// AcceptSession waits for a peer to open a session with Dial.
+// Serve must be running for sessions to arrive.
+func (c *Client) AcceptSession(ctx context.Context) (Session, error) {
+	select {
+	case s := <-c.incomingSessions:
+		<-c.sessionSlots
+		return s, nil
+	case <-c.done:
+		return nil, errors.New("client is closed")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// dial opens a session and returns the concrete type for internal callers.
+// Only sessions opened for the application carry streams opened with
+// OpenStream and are reported by the peer's AcceptSession.
+func (c *Client) dial(ctx context.Context, peerID string, application bool) (*session, error) {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return nil, errors.New("client is closed")
+	}
+	c.mu.RUnlock()
+
+	if peerID == "" {
+		return nil, errors.New("peer ID cannot be empty")
+	}
+
+	stream, err := c.transport.ConnectToPeer(ctx, peerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to peer %s: %w", peerID, err)
+	}
+
+	var options map[string]string
+	if application {
+		options = map[string]string{optApplication: "true"}
+	}
+
+	localPeerID := c.transport.LocalPeerID()
+	err = handshake(ctx, stream, handshakeRequest{
+		Kind:     StreamKindSession,
+		Metadata: c.handshakeMetadata(),
+		Options:  options,
+	})
+	if err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("session handshake with peer %s failed: %w", peerID, err)
+	}
+
+	mux, err := yamux.Client(stream, muxConfig())
+	if err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("failed to start session: %w", err)
+	}
+
+	s := &session{
+		peerID:      peerID,
+		localPeerID: localPeerID,
+		client:      c,
+		mux:         mux,
+		dialed:      true,
+	}
+	if application {
+		s.streams = make(chan *connection, streamBacklog)
+		s.slots = make(chan struct{}, streamBacklog)
+	}
+	c.sessions.add(s)
+	c.notifyConnect(peerID)
+
+	go c.acceptSessionStreams(s, peerID)
+
+	return s, nil
+}
+
+// serveSession runs the accepting side of a session on an incoming stream
+// from peerID, which the transport authenticated. Streams opened by the
+// remote peer are dispatched like any incoming stream from it. remote is the
+// peer ID reported for the session. It blocks until the session ends.
+func (c *Client) serveSession(stream io.ReadWriteCloser, req handshakeRequest, peerID, remote string) {
+	application := req.Options[optApplication] == "true"
+	if application {
+		// Reserve a place in the AcceptSession backlog
+		select {
+		case c.sessionSlots <- struct{}{}:
+		default:
+			rejectHandshake(stream, HandshakeBusy, fmt.Sprintf("%d sessions waiting to be accepted", sessionBacklog))
+			return
+		}
+	}
+
+	s, err := c.startSession(stream, remote, application)
+	if err != nil {
+		if application {
+			<-c.sessionSlots
+		}
+		fmt.Printf("failed to start session: %v\n", err)
+		return
+	}
+	defer s.Close()
+
+	if application {
+		c.incomingSessions <- s
+	}
+
+	c.acceptSessionStreams(s, peerID)
+}
+
+// startSession acknowledges an incoming session and registers it
+func (c *Client) startSession(stream io.ReadWriteCloser, remote string, application bool) (*session, error) {
+	if err := writeHandshakeResponse(stream, HandshakeOK, ""); err != nil {
+		return nil, err
+	}
+
+	mux, err := yamux.Server(stream, muxConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	s := &session{
+		peerID:      remote,
+		localPeerID: c.transport.LocalPeerID(),
+		client:      c,
+		mux:         mux,
+	}
+	if application {
+		s.streams = make(chan *connection, streamBacklog)
+		s.slots = make(chan struct{}, streamBacklog)
+	}
+	c.sessions.add(s)
+
+	return s, nil
+}
+
+// acceptSessionStreams dispatches the streams the peer opens within s until
+// the session ends. peerID is the peer the transport authenticated.
+func (c *Client) acceptSessionStreams(s *session, peerID string) {
+	for {
+		stream, err := s.mux.AcceptStream()
+		if err != nil {
+			return
+		}
+		go c.serveStream(muxStream{stream}, peerID, s)
+	}
+}
+
+// serveSessionStream queues a stream the peer opened with OpenStream for
+// AcceptStream. It reports whether the session took ownership of the stream.
+func (s *session) serveSessionStream(stream io.ReadWriteCloser) bool {
+	ms, ok := stream.(muxStream)
+	if !ok || s.streams == nil {
+		rejectHandshake(stream, HandshakeUnsupportedKind, "stream outside an application session")
+		return false
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		rejectHandshake(stream, HandshakeBusy, fmt.Sprintf("%d streams waiting to be accepted", streamBacklog))
+		return false
+	}
+
+	if err := writeHandshakeResponse(stream, HandshakeOK, ""); err != nil {
+		<-s.slots
+		fmt.Printf("failed to acknowledge stream: %v\n", err)
+		return false
+	}
+
+	s.streams <- s.wrap(ms)
+	return true
+}
+
+// muxConfig returns the yamux configuration used for sessions. yamux logs
+// every session that ends, even normally, so its output is discarded; the
+// errors reach callers through the session and its streams.
+func muxConfig() *yamux.Config {
+	config := yamux.DefaultConfig()
+	config.LogOutput = io.Discard
+	return config
+}
+
+// ID returns the session identifier
+func (s *session) ID() string {
+	return s.id
+}
+
+// PeerID returns the remote peer identifier
+func (s *session) PeerID() string {
+	return s.peerID
+}
+
+// OpenStream opens a new logical stream to the peer
+func (s *session) OpenStream(ctx context.Context) (Connection, error) {
+	conn, err := s.openStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hsCtx, cancel := context.WithTimeout(ctx, s.client.config.Timeout)
+	defer cancel()
+
+	err = handshake(hsCtx, conn, handshakeRequest{
+		Kind:     StreamKindStream,
+		Metadata: s.client.handshakeMetadata(),
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("stream handshake with peer %s failed: %w", s.peerID, err)
+	}
+
+	return conn, nil
+}
+
+// AcceptStream waits for the peer to open a stream with OpenStream
+func (s *session) AcceptStream(ctx context.Context) (Connection, error) {
+	if s.streams == nil {
+		return nil, errors.New("session does not accept streams")
+	}
+
+	select {
+	case conn := <-s.streams:
+		<-s.slots
+		return conn, nil
+	case <-s.mux.CloseChan():
+		return nil, errors.New("session is closed")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// openStream opens a stream without a handshake, for internal callers that
+// send their own
+func (s *session) openStream(ctx context.Context) (*connection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		stream *yamux.Stream
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stream, err := s.mux.OpenStream()
+		done <- result{stream, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.stream != nil {
+				r.stream.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	case r := <-done:
+		if r.err != nil {
+			return nil, fmt.Errorf("failed to open stream: %w", r.err)
+		}
+		return s.wrap(muxStream{r.stream}), nil
+	}
+}
+
+// acceptStream waits for the peer to open a stream without a handshake, on
+// sessions whose streams are not dispatched
+func (s *session) acceptStream(ctx context.Context) (*connection, error) {
+	stream, err := s.mux.AcceptStreamWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept stream: %w", err)
+	}
+	return s.wrap(muxStream{stream}), nil
+}
+
+// wrap turns a yamux stream into a Connection
+func (s *session) wrap(stream muxStream) *connection {
+	return &connection{
+		id:          fmt.Sprintf("%s/%d", s.id, stream.StreamID()),
+		peerID:      s.peerID,
+		localPeerID: s.localPeerID,
+		connected:   true,
+		connectedAt: time.Now(),
+		bridgeConn:  stream,
+	}
+}
+
+// NumStreams returns the number of open streams
+func (s *session) NumStreams() int {
+	return s.mux.NumStreams()
+}
+
+// IsClosed reports whether the session has been closed
+func (s *session) IsClosed() bool {
+	return s.mux.IsClosed()
+}
+
+// Close closes the session and all of its streams
+func (s *session) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	err := s.mux.Close()
+
+	if s.client != nil {
+		s.client.sessions.remove(s)
+		if s.dialed {
+			s.client.notifyDisconnect(s.peerID, err)
+		}
+	}
+
+	return err
+}
+
+// muxStream adapts a yamux stream to the Stream deadline error contract
+type muxStream struct {
+	*yamux.Stream
+}
+
+// Read reads data from the stream
+func (m muxStream) Read(b []byte) (int, error) {
+	n, err := m.Stream.Read(b)
+	return n, muxError(err)
+}
+
+// Write writes data to the stream
+func (m muxStream) Write(b []byte) (int, error) {
+	n, err := m.Stream.Write(b)
+	return n, muxError(err)
+}
+
+// muxError maps yamux deadline errors to os.ErrDeadlineExceeded
+func muxError(err error) error {
+	if err == yamux.ErrTimeout {
+		return os.ErrDeadlineExceeded
+	}
+	return err
+}
+
+// sessionRegistry tracks live sessions by session ID
+type sessionRegistry struct {
+	mu       sync.RWMutex
+	sessions map[string]*session
+	nextID   uint64
+}
+
+// newSessionRegistry creates an empty session registry
+func newSessionRegistry() *sessionRegistry {
+	return &sessionRegistry{
+		sessions: make(map[string]*session),
+	}
+}
+
+// add assigns the session an ID and registers it
+func (r *sessionRegistry) add(s *session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	s.id = fmt.Sprintf("%s/s%d", s.peerID, r.nextID)
+	r.sessions[s.id] = s
+}
+
+// remove unregisters the session
+func (r *sessionRegistry) remove(s *session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, s.id)
+}
+
+// list returns all live sessions
+func (r *sessionRegistry) list() []*session {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sessions := make([]*session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// closeAll closes every registered session
+func (r *sessionRegistry) closeAll() error {
+	var errs []error
+	for _, s := range r.list() {
+		if err := s.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("session %s: %w", s.id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,324 @@
+package cloudbridge_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+// countingTransport counts the streams opened with ConnectToPeer
+type countingTransport struct {
+	*memtransport.Transport
+	opened atomic.Int32
+}
+
+func (c *countingTransport) ConnectToPeer(ctx context.Context, peerID string) (cloudbridge.Stream, error) {
+	c.opened.Add(1)
+	return c.Transport.ConnectToPeer(ctx, peerID)
+}
+
+// newSessionPair dials a session from alice to bob and accepts it on bob
+func newSessionPair(t *testing.T) (*cloudbridge.Client, *countingTransport, cloudbridge.Session, cloudbridge.Session) {
+	t.Helper()
+
+	network := memtransport.NewNetwork()
+	transport := &countingTransport{Transport: network.NewTransport("alice")}
+	alice, err := cloudbridge.NewClient(cloudbridge.WithToken("test-token"), cloudbridge.WithTransport(transport))
+	if err != nil {
+		t.Fatalf("Failed to create client alice: %v", err)
+	}
+	t.Cleanup(func() { alice.Close() })
+
+	bob := newTestClient(t, network, "bob")
+	serve(t, network, bob, "bob")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dialed, err := alice.Dial(ctx, "bob")
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	accepted, err := bob.AcceptSession(ctx)
+	if err != nil {
+		t.Fatalf("AcceptSession() error = %v", err)
+	}
+	if accepted.PeerID() != "alice" {
+		t.Errorf("accepted PeerID() = %v, want alice", accepted.PeerID())
+	}
+
+	return alice, transport, dialed, accepted
+}
+
+// echoStreams echoes every stream the peer opens in s
+func echoStreams(s cloudbridge.Session) {
+	for {
+		stream, err := s.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			defer stream.Close()
+			io.Copy(stream, stream)
+		}()
+	}
+}
+
+func TestSessionOpenStreams(t *testing.T) {
+	_, transport, dialed, accepted := newSessionPair(t)
+	go echoStreams(accepted)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			stream, err := dialed.OpenStream(context.Background())
+			if err != nil {
+				t.Errorf("OpenStream() error = %v", err)
+				return
+			}
+			defer stream.Close()
+			stream.SetDeadline(time.Now().Add(5 * time.Second))
+
+			want := fmt.Sprintf("stream %d", i)
+			if _, err := stream.Write([]byte(want)); err != nil {
+				t.Errorf("Write() error = %v", err)
+				return
+			}
+
+			got := make([]byte, len(want))
+			if _, err := io.ReadFull(stream, got); err != nil {
+				t.Errorf("ReadFull() error = %v", err)
+				return
+			}
+			if string(got) != want {
+				t.Errorf("echo = %q, want %q", got, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if opened := transport.opened.Load(); opened != 1 {
+		t.Errorf("session opened %d transport streams, want 1", opened)
+	}
+}
+
+func TestSessionAcceptStream(t *testing.T) {
+	_, _, dialed, accepted := newSessionPair(t)
+
+	go func() {
+		stream, err := accepted.OpenStream(context.Background())
+		if err != nil {
+			return
+		}
+		stream.Write([]byte("ping"))
+		stream.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := dialed.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream() error = %v", err)
+	}
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(data) != "ping" {
+		t.Errorf("received %q, want %q", data, "ping")
+	}
+	if stream.PeerID() != "bob" {
+		t.Errorf("PeerID() = %v, want %v", stream.PeerID(), "bob")
+	}
+}
+
+func TestSessionAcceptStreamCanceled(t *testing.T) {
+	_, _, dialed, _ := newSessionPair(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := dialed.AcceptStream(ctx); err != context.DeadlineExceeded {
+		t.Errorf("AcceptStream() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSessionTunnelsNotAccepted(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+	serve(t, network, bob, "bob")
+
+	// Tunnels use sessions of their own, which AcceptSession does not report
+	tunnel, err := alice.CreateTunnel(context.Background(), cloudbridge.TunnelConfig{
+		LocalAddr:  "127.0.0.1",
+		RemotePeer: "bob",
+		RemotePort: startEchoServer(t),
+	})
+	if err != nil {
+		t.Fatalf("CreateTunnel() error = %v", err)
+	}
+	defer tunnel.Close()
+
+	conn, err := net.Dial("tcp", tunnel.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ping"))
+	if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+		t.Fatalf("ReadFull() through tunnel error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if s, err := bob.AcceptSession(ctx); err == nil {
+		t.Errorf("AcceptSession() returned tunnel session %s", s.ID())
+	}
+}
+
+func TestSessionClose(t *testing.T) {
+	alice, _, dialed, _ := newSessionPair(t)
+
+	stream, err := dialed.OpenStream(context.Background())
+	if err != nil {
+		t.Fatalf("OpenStream() error = %v", err)
+	}
+
+	if err := alice.Close(); err != nil {
+		t.Fatalf("Client.Close() error = %v", err)
+	}
+
+	if !dialed.IsClosed() {
+		t.Error("Client.Close() did not close the session")
+	}
+
+	if _, err := stream.Write([]byte("test")); err == nil {
+		t.Error("Write() on stream of closed session should fail")
+	}
+
+	if _, err := dialed.OpenStream(context.Background()); err == nil {
+		t.Error("OpenStream() on closed session should fail")
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// cancelingTransport ends its streams the way QUIC streams do, with an
+// error yamux does not take for a normal close
+type cancelingTransport struct {
+	*memtransport.Transport
+}
+
+func (c cancelingTransport) ConnectToPeer(ctx context.Context, peerID string) (cloudbridge.Stream, error) {
+	stream, err := c.Transport.ConnectToPeer(ctx, peerID)
+	if err != nil {
+		return nil, err
+	}
+	return canceledStream{stream}, nil
+}
+
+type canceledStream struct {
+	cloudbridge.Stream
+}
+
+func (s canceledStream) Read(p []byte) (int, error) {
+	n, err := s.Stream.Read(p)
+	if err != nil {
+		err = errors.New("stream canceled by remote with error code 0")
+	}
+	return n, err
+}
+
+func TestSessionCloseDoesNotLog(t *testing.T) {
+	var logged syncBuffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	network := memtransport.NewNetwork()
+	alice, err := cloudbridge.NewClient(
+		cloudbridge.WithToken("test-token"),
+		cloudbridge.WithTransport(cancelingTransport{network.NewTransport("alice")}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client alice: %v", err)
+	}
+	defer alice.Close()
+	bob := newTestClient(t, network, "bob")
+	serve(t, network, bob, "bob")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dialed, err := alice.Dial(ctx, "bob")
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	accepted, err := bob.AcceptSession(ctx)
+	if err != nil {
+		t.Fatalf("AcceptSession() error = %v", err)
+	}
+
+	// The peer ending the session is normal, not worth a log line
+	accepted.Close()
+	waitFor(t, "dialed session to close", dialed.IsClosed)
+
+	if out := logged.String(); out != "" {
+		t.Errorf("closing a session logged %q, want nothing", out)
+	}
+}
+
+func TestSessionStreamDeadline(t *testing.T) {
+	_, _, dialed, accepted := newSessionPair(t)
+	go echoStreams(accepted)
+
+	stream, err := dialed.OpenStream(context.Background())
+	if err != nil {
+		t.Fatalf("OpenStream() error = %v", err)
+	}
+	defer stream.Close()
+
+	stream.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := stream.Read(make([]byte, 16)); !isTimeout(err) {
+		t.Errorf("Read() error = %v, want timeout", err)
+	}
+}
+
+// isTimeout reports whether err is a net.Error timeout
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
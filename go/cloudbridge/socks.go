@@ -0,0 +1,235 @@
+package cloudbridge
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SOCKS5 protocol constants (RFC 1928)
+const (
+	socksVersion = 0x05
+
+	socksMethodNoAuth       = 0x00
+	socksMethodNoAcceptable = 0xff
+
+	socksCmdConnect = 0x01
+
+	socksAddrIPv4   = 0x01
+	socksAddrDomain = 0x03
+	socksAddrIPv6   = 0x04
+
+	socksReplySucceeded          = 0x00
+	socksReplyGeneralFailure     = 0x01
+	socksReplyNotAllowed         = 0x02
+	socksReplyHostUnreachable    = 0x04
+	socksReplyConnectionRefused  = 0x05
+	socksReplyCommandUnsupported = 0x07
+	socksReplyAddressUnsupported = 0x08
+)
+
+// ServeSOCKS5 runs a SOCKS5 proxy on listenAddr until ctx is done.
+// CONNECT requests for peer addresses (<peer-id>.cb, <service>.<peer-id>.cb)
+// go to that peer; other hosts go through the gateway set with
+// WithGatewayPeer and are resolved on the gateway. Only the CONNECT command
+// without authentication is supported, so listenAddr should not be
+// reachable by untrusted clients.
+func (c *Client) ServeSOCKS5(ctx context.Context, listenAddr string, opts ...ProxyOption) error {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return errors.New("client is closed")
+	}
+	c.mu.RUnlock()
+
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to start SOCKS5 listener: %w", err)
+	}
+
+	return c.serveSOCKS5(ctx, listener, newProxyConfig(opts))
+}
+
+// serveSOCKS5 accepts SOCKS5 clients on listener until ctx is done
+func (c *Client) serveSOCKS5(ctx context.Context, listener net.Listener, config proxyConfig) error {
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	defer stop()
+	defer listener.Close()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept SOCKS5 connection: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.handleSOCKS5(ctx, conn, config)
+		}()
+	}
+}
+
+// handleSOCKS5 serves one SOCKS5 client connection
+func (c *Client) handleSOCKS5(ctx context.Context, conn net.Conn, config proxyConfig) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	conn.SetDeadline(time.Now().Add(c.config.Timeout))
+	addr, err := readSOCKS5Request(conn)
+	if err != nil {
+		fmt.Printf("SOCKS5 request from %s failed: %v\n", conn.RemoteAddr(), err)
+		return
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	remoteConn, err := c.dialProxy(dialCtx, config, addr)
+	cancel()
+	if err != nil {
+		fmt.Printf("SOCKS5 connect to %s failed: %v\n", addr, err)
+		writeSOCKS5Reply(conn, socksReplyCode(err))
+		return
+	}
+	defer remoteConn.Close()
+
+	if err := writeSOCKS5Reply(conn, socksReplySucceeded); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	go func() {
+		io.Copy(remoteConn, conn)
+		remoteConn.Close()
+	}()
+	io.Copy(conn, remoteConn)
+}
+
+// socksError is a request error with the reply code to send for it
+type socksError struct {
+	reply byte
+	msg   string
+}
+
+func (e *socksError) Error() string { return e.msg }
+
+// readSOCKS5Request performs method negotiation and reads a CONNECT
+// request, returning its host:port. Protocol errors are answered before
+// returning.
+func readSOCKS5Request(conn net.Conn) (string, error) {
+	// Method selection: VER NMETHODS METHODS...
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socksVersion {
+		return "", fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+
+	method := byte(socksMethodNoAcceptable)
+	for _, m := range methods {
+		if m == socksMethodNoAuth {
+			method = socksMethodNoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return "", err
+	}
+	if method == socksMethodNoAcceptable {
+		return "", errors.New("client does not support unauthenticated access")
+	}
+
+	addr, err := readSOCKS5Addr(conn)
+	var sErr *socksError
+	if errors.As(err, &sErr) {
+		writeSOCKS5Reply(conn, sErr.reply)
+	}
+	return addr, err
+}
+
+// readSOCKS5Addr reads a request: VER CMD RSV ATYP DST.ADDR DST.PORT
+func readSOCKS5Addr(conn net.Conn) (string, error) {
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", err
+	}
+	if request[0] != socksVersion {
+		return "", fmt.Errorf("unsupported SOCKS version %d", request[0])
+	}
+
+	var host string
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if request[3] == socksAddrIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socksAddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", err
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		return "", &socksError{socksReplyAddressUnsupported, fmt.Sprintf("unsupported address type %d", request[3])}
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+
+	if request[1] != socksCmdConnect {
+		return "", &socksError{socksReplyCommandUnsupported, fmt.Sprintf("unsupported command %d", request[1])}
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// writeSOCKS5Reply sends a reply with an unspecified bound address
+func writeSOCKS5Reply(w io.Writer, reply byte) error {
+	_, err := w.Write([]byte{socksVersion, reply, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// socksReplyCode maps a dial error to a SOCKS5 reply code
+func socksReplyCode(err error) byte {
+	var hsErr *HandshakeError
+	switch {
+	case errors.As(err, &hsErr) && hsErr.Code == HandshakeForbidden:
+		return socksReplyNotAllowed
+	case errors.As(err, &hsErr) && hsErr.Code == HandshakeTargetUnreachable:
+		return socksReplyConnectionRefused
+	case errors.Is(err, errNoGateway):
+		return socksReplyNotAllowed
+	case errors.As(err, &hsErr):
+		return socksReplyGeneralFailure
+	default:
+		return socksReplyHostUnreachable
+	}
+}
@@ -0,0 +1,107 @@
+package cloudbridge_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+// socksConnect performs a SOCKS5 CONNECT for a domain address and returns
+// the reply code
+func socksConnect(t *testing.T, conn net.Conn, cmd byte, host string, port int) byte {
+	t.Helper()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(conn, method); err != nil || method[1] != 0 {
+		t.Fatalf("method selection = %v, %v", method, err)
+	}
+
+	req := append([]byte{5, cmd, 0, 3, byte(len(host))}, host...)
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("ReadFull() reply error = %v", err)
+	}
+	return reply[1]
+}
+
+func TestServeSOCKS5(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+	serve(t, network, bob, "bob")
+
+	echoPort := startEchoServer(t)
+	proxyAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(freePort(t)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- alice.ServeSOCKS5(ctx, proxyAddr, cloudbridge.WithGatewayPeer("bob")) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("ServeSOCKS5() error = %v", err)
+		}
+	}()
+
+	waitFor(t, "SOCKS5 listener", func() bool {
+		conn, err := net.Dial("tcp", proxyAddr)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	})
+
+	tests := []struct {
+		name      string
+		cmd       byte
+		host      string
+		port      int
+		wantReply byte
+	}{
+		{name: "peer address", cmd: 1, host: "bob.cb", port: echoPort, wantReply: 0},
+		{name: "host through gateway", cmd: 1, host: "127.0.0.1", port: echoPort, wantReply: 0},
+		{name: "refused on gateway", cmd: 1, host: "127.0.0.1", port: freePort(t), wantReply: 5},
+		{name: "denied on gateway", cmd: 1, host: "10.0.0.5", port: 5432, wantReply: 2},
+		{name: "unsupported command", cmd: 2, host: "bob.cb", port: echoPort, wantReply: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", proxyAddr)
+			if err != nil {
+				t.Fatalf("Failed to dial proxy: %v", err)
+			}
+			defer conn.Close()
+
+			if reply := socksConnect(t, conn, tt.cmd, tt.host, tt.port); reply != tt.wantReply {
+				t.Fatalf("reply = %d, want %d", reply, tt.wantReply)
+			}
+			if tt.wantReply != 0 {
+				return
+			}
+
+			if _, err := conn.Write([]byte("ping")); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			buf := make([]byte, 4)
+			if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+				t.Errorf("ReadFull() = %q, %v, want ping", buf, err)
+			}
+		})
+	}
+}
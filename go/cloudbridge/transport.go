@@ -3,15 +3,71 @@ package cloudbridge
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/internal/bridge"
 	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/internal/jwt"
 )
 
-// transport manages the underlying transport layer using bridge
-type transport struct {
+// Transport is the peer-to-peer transport used by a Client.
+// The default implementation talks to the CloudBridge relay; alternative
+// implementations (such as the in-memory memtransport package) can be
+// supplied with WithTransport.
+type Transport interface {
+	// ConnectToPeer opens a bidirectional stream to the given peer
+	ConnectToPeer(ctx context.Context, peerID string) (Stream, error)
+
+	// Broadcast sends data to all connected peers
+	Broadcast(ctx context.Context, data []byte) error
+
+	// Send sends data to a specific peer
+	Send(ctx context.Context, peerID string, data []byte) error
+
+	// GetMeshPeers returns a list of connected peers in the mesh
+	GetMeshPeers() []string
+
+	// SetStreamHandler sets the handler for incoming streams
+	SetStreamHandler(handler StreamHandler)
+
+	// SetMessageHandler sets the handler for data other peers send with
+	// Broadcast or Send
+	SetMessageHandler(handler MessageHandler)
+
+	// LocalPeerID returns the peer ID of the local node
+	LocalPeerID() string
+
+	// Close closes the transport and releases all resources
+	Close() error
+}
+
+// Stream is a bidirectional byte stream to a peer.
+// Deadline errors must wrap os.ErrDeadlineExceeded, as net.Conn does.
+type Stream interface {
+	io.ReadWriteCloser
+
+	// SetDeadline sets the read and write deadlines
+	SetDeadline(t time.Time) error
+
+	// SetReadDeadline sets the read deadline
+	SetReadDeadline(t time.Time) error
+
+	// SetWriteDeadline sets the write deadline
+	SetWriteDeadline(t time.Time) error
+}
+
+// StreamHandler is called for every stream opened by a remote peer.
+// peerID is empty if the transport cannot identify the remote peer.
+type StreamHandler func(peerID string, stream Stream)
+
+// MessageHandler is called for every mesh message received from a peer.
+// peerID is empty if the transport cannot identify the sender.
+type MessageHandler func(peerID string, data []byte)
+
+// relayTransport manages the underlying transport layer using bridge
+type relayTransport struct {
 	config *Config
 	bridge *bridge.ClientBridge
 	logger *defaultLogger
@@ -19,8 +75,8 @@ type transport struct {
 	closed bool
 }
 
-// newTransport creates a new transport layer
-func newTransport(config *Config) (*transport, error) {
+// newTransport creates a new relay transport layer
+func newTransport(config *Config) (*relayTransport, error) {
 	logger := &defaultLogger{}
 
 	bridgeConfig := &bridge.BridgeConfig{
@@ -38,7 +94,7 @@ func newTransport(config *Config) (*transport, error) {
 		return nil, fmt.Errorf("failed to create bridge: %w", err)
 	}
 
-	return &transport{
+	return &relayTransport{
 		config: config,
 		bridge: clientBridge,
 		logger: logger,
@@ -46,7 +102,7 @@ func newTransport(config *Config) (*transport, error) {
 }
 
 // initialize initializes the transport
-func (t *transport) initialize(ctx context.Context) error {
+func (t *relayTransport) initialize(ctx context.Context) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -61,8 +117,8 @@ func (t *transport) initialize(ctx context.Context) error {
 	return nil
 }
 
-// connectToPeer connects to a peer
-func (t *transport) connectToPeer(ctx context.Context, peerID string) (*connection, error) {
+// ConnectToPeer connects to a peer
+func (t *relayTransport) ConnectToPeer(ctx context.Context, peerID string) (Stream, error) {
 	t.mu.RLock()
 	if t.closed {
 		t.mu.RUnlock()
@@ -75,18 +131,11 @@ func (t *transport) connectToPeer(ctx context.Context, peerID string) (*connecti
 		return nil, fmt.Errorf("failed to connect to peer: %w", err)
 	}
 
-	conn := &connection{
-		peerID:      peerID,
-		connected:   true,
-		connectedAt: peerConn.ConnectedAt,
-		bridgeConn:  peerConn,
-	}
-
-	return conn, nil
+	return peerConn, nil
 }
 
-// close closes the transport
-func (t *transport) close() error {
+// Close closes the transport
+func (t *relayTransport) Close() error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -103,8 +152,8 @@ func (t *transport) close() error {
 	return nil
 }
 
-// broadcast sends data to all connected peers
-func (t *transport) broadcast(ctx context.Context, data []byte) error {
+// Broadcast sends data to all connected peers
+func (t *relayTransport) Broadcast(ctx context.Context, data []byte) error {
 	t.mu.RLock()
 	if t.closed {
 		t.mu.RUnlock()
@@ -115,8 +164,8 @@ func (t *transport) broadcast(ctx context.Context, data []byte) error {
 	return t.bridge.Broadcast(ctx, data)
 }
 
-// send sends data to a specific peer
-func (t *transport) send(ctx context.Context, peerID string, data []byte) error {
+// Send sends data to a specific peer
+func (t *relayTransport) Send(ctx context.Context, peerID string, data []byte) error {
 	t.mu.RLock()
 	if t.closed {
 		t.mu.RUnlock()
@@ -127,8 +176,8 @@ func (t *transport) send(ctx context.Context, peerID string, data []byte) error
 	return t.bridge.Send(ctx, peerID, data)
 }
 
-// getMeshPeers returns a list of connected peers in the mesh
-func (t *transport) getMeshPeers() []string {
+// GetMeshPeers returns a list of connected peers in the mesh
+func (t *relayTransport) GetMeshPeers() []string {
 	t.mu.RLock()
 	if t.closed {
 		t.mu.RUnlock()
@@ -139,6 +188,35 @@ func (t *transport) getMeshPeers() []string {
 	return t.bridge.GetMeshPeers()
 }
 
+// SetStreamHandler sets the handler for incoming streams.
+// The relay does not identify the opener of a stream, so peerID is empty.
+func (t *relayTransport) SetStreamHandler(handler StreamHandler) {
+	t.bridge.SetStreamHandler(func(stream *bridge.IncomingStream) {
+		handler("", stream)
+	})
+}
+
+// SetMessageHandler sets the handler for mesh messages.
+// The relay does not identify the sender, so peerID is empty.
+func (t *relayTransport) SetMessageHandler(handler MessageHandler) {
+	t.setClaimedMessageHandler(func(peerID, sender string, data []byte) {
+		handler(peerID, data)
+	})
+}
+
+// setClaimedMessageHandler is SetMessageHandler that also passes the peer
+// ID the sender claims, which is not verified
+func (t *relayTransport) setClaimedMessageHandler(handler func(peerID, sender string, data []byte)) {
+	t.bridge.SetMessageHandler(func(sender string, data []byte) {
+		handler("", sender, data)
+	})
+}
+
+// LocalPeerID returns the peer ID assigned by the relay
+func (t *relayTransport) LocalPeerID() string {
+	return t.bridge.GetPeerID()
+}
+
 // extractTenantID extracts tenant ID from JWT token
 func extractTenantID(token string) string {
 	tenantID, err := jwt.ExtractTenantID(token)
@@ -2,10 +2,148 @@ package cloudbridge
 
 import (
 	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
 	"testing"
 	"time"
 )
 
+// pipeTransport is an in-memory Transport for client tests.
+// Each stream is a net.Pipe whose remote end is kept in accepted.
+type pipeTransport struct {
+	mu       sync.Mutex
+	peerID   string
+	accepted []net.Conn
+	handler  StreamHandler
+	closed   bool
+	refuse   bool     // makes ConnectToPeer fail
+	peers    []string // reported by GetMeshPeers
+}
+
+func (p *pipeTransport) ConnectToPeer(ctx context.Context, peerID string) (Stream, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, errors.New("transport is closed")
+	}
+	if p.refuse {
+		return nil, errors.New("peer unreachable")
+	}
+
+	local, remote := net.Pipe()
+	p.accepted = append(p.accepted, remote)
+	return local, nil
+}
+
+func (p *pipeTransport) Broadcast(ctx context.Context, data []byte) error { return nil }
+
+func (p *pipeTransport) Send(ctx context.Context, peerID string, data []byte) error { return nil }
+
+func (p *pipeTransport) GetMeshPeers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.peers...)
+}
+
+func (p *pipeTransport) SetStreamHandler(handler StreamHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handler = handler
+}
+
+func (p *pipeTransport) SetMessageHandler(handler MessageHandler) {}
+
+func (p *pipeTransport) LocalPeerID() string { return p.peerID }
+
+func (p *pipeTransport) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, conn := range p.accepted {
+		conn.Close()
+	}
+	return nil
+}
+
+// remote returns the remote end of the i-th stream, waiting for it to be opened
+func (p *pipeTransport) remote(t *testing.T, i int) net.Conn {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		p.mu.Lock()
+		if len(p.accepted) > i {
+			conn := p.accepted[i]
+			p.mu.Unlock()
+			return conn
+		}
+		p.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("stream %d was not opened", i)
+	return nil
+}
+
+// setRefuse toggles connection refusal
+func (p *pipeTransport) setRefuse(refuse bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refuse = refuse
+}
+
+// setPeers sets the peers reported by GetMeshPeers
+func (p *pipeTransport) setPeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers = peers
+}
+
+// newPipeClient creates a client backed by a pipeTransport
+func newPipeClient(t *testing.T, opts ...Option) (*Client, *pipeTransport) {
+	t.Helper()
+
+	tr := &pipeTransport{peerID: "local-peer"}
+	opts = append([]Option{WithToken("test-token"), WithTransport(tr)}, opts...)
+
+	client, err := NewClient(opts...)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client, tr
+}
+
+// startEchoServer starts a TCP echo server on a loopback port
+func startEchoServer(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start echo server: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
 func TestNewTransport(t *testing.T) {
 	config := &Config{
 		Token:    "test-token",
@@ -85,19 +223,19 @@ func TestTransportClose(t *testing.T) {
 		t.Fatalf("newTransport() error = %v", err)
 	}
 
-	err = transport.close()
+	err = transport.Close()
 	if err != nil {
-		t.Errorf("close() error = %v", err)
+		t.Errorf("Close() error = %v", err)
 	}
 
 	if !transport.closed {
-		t.Error("close() did not set closed flag")
+		t.Error("Close() did not set closed flag")
 	}
 
 	// Second close should be idempotent
-	err = transport.close()
+	err = transport.Close()
 	if err != nil {
-		t.Errorf("Second close() error = %v", err)
+		t.Errorf("Second Close() error = %v", err)
 	}
 }
 
@@ -121,9 +259,9 @@ func TestTransportCloseBeforeInitialize(t *testing.T) {
 		t.Fatalf("newTransport() error = %v", err)
 	}
 
-	err = transport.close()
+	err = transport.Close()
 	if err != nil {
-		t.Errorf("close() error = %v", err)
+		t.Errorf("Close() error = %v", err)
 	}
 
 	// Try to initialize after close
@@ -153,13 +291,13 @@ func TestTransportConnectToPeer(t *testing.T) {
 	if err != nil {
 		t.Fatalf("newTransport() error = %v", err)
 	}
-	defer transport.close()
+	defer transport.Close()
 
 	ctx := context.Background()
-	_, err = transport.connectToPeer(ctx, "peer-123")
+	_, err = transport.ConnectToPeer(ctx, "peer-123")
 	// This will fail if bridge is not initialized, which is expected in tests
 	if err != nil {
-		t.Logf("connectToPeer() error (may be expected): %v", err)
+		t.Logf("ConnectToPeer() error (may be expected): %v", err)
 	}
 }
 
@@ -183,12 +321,12 @@ func TestTransportConnectToPeerClosed(t *testing.T) {
 		t.Fatalf("newTransport() error = %v", err)
 	}
 
-	transport.close()
+	transport.Close()
 
 	ctx := context.Background()
-	_, err = transport.connectToPeer(ctx, "peer-123")
+	_, err = transport.ConnectToPeer(ctx, "peer-123")
 	if err == nil {
-		t.Error("connectToPeer() should fail when transport is closed")
+		t.Error("ConnectToPeer() should fail when transport is closed")
 	}
 }
 
@@ -211,13 +349,13 @@ func TestTransportBroadcast(t *testing.T) {
 	if err != nil {
 		t.Fatalf("newTransport() error = %v", err)
 	}
-	defer transport.close()
+	defer transport.Close()
 
 	ctx := context.Background()
-	err = transport.broadcast(ctx, []byte("test message"))
+	err = transport.Broadcast(ctx, []byte("test message"))
 	// This will fail if bridge is not initialized, which is expected in tests
 	if err != nil {
-		t.Logf("broadcast() error (may be expected): %v", err)
+		t.Logf("Broadcast() error (may be expected): %v", err)
 	}
 }
 
@@ -240,13 +378,13 @@ func TestTransportSend(t *testing.T) {
 	if err != nil {
 		t.Fatalf("newTransport() error = %v", err)
 	}
-	defer transport.close()
+	defer transport.Close()
 
 	ctx := context.Background()
-	err = transport.send(ctx, "peer-123", []byte("test message"))
+	err = transport.Send(ctx, "peer-123", []byte("test message"))
 	// This will fail if bridge is not initialized, which is expected in tests
 	if err != nil {
-		t.Logf("send() error (may be expected): %v", err)
+		t.Logf("Send() error (may be expected): %v", err)
 	}
 }
 
@@ -269,11 +407,11 @@ func TestTransportGetMeshPeers(t *testing.T) {
 	if err != nil {
 		t.Fatalf("newTransport() error = %v", err)
 	}
-	defer transport.close()
+	defer transport.Close()
 
-	peers := transport.getMeshPeers()
+	peers := transport.GetMeshPeers()
 	if peers == nil {
-		t.Error("getMeshPeers() returned nil")
+		t.Error("GetMeshPeers() returned nil")
 	}
 	// Peers list might be empty if bridge is not initialized
 	_ = peers
@@ -6,7 +6,13 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Tunnel represents a secure tunnel
@@ -17,9 +23,19 @@ type Tunnel interface {
 	// LocalPort returns the local port
 	LocalPort() int
 
+	// LocalAddr returns the address of the local listener, or nil for
+	// reverse tunnels
+	LocalAddr() net.Addr
+
+	// RemoteHost returns the host the remote peer connects to
+	RemoteHost() string
+
 	// RemotePort returns the remote port
 	RemotePort() int
 
+	// Stats returns a snapshot of the tunnel activity
+	Stats() TunnelStats
+
 	// Close closes the tunnel
 	Close() error
 }
@@ -30,11 +46,40 @@ type TunnelConfig struct {
 	RemotePeer string
 	RemotePort int
 	Protocol   Protocol
+
+	// RemoteHost is the host the remote peer connects to, letting the peer
+	// act as a gateway into its network. Targets other than the peer's own
+	// machine must be allowed by the peer's TunnelPolicy
+	// (default: localhost).
+	RemoteHost string
+
+	// LocalAddr is the host or IP the local listener binds to, such as
+	// 127.0.0.1, or "unix:" followed by a path to listen on a Unix domain
+	// socket, which only TCP tunnels support (default: all interfaces).
+	// Set LocalPort to 0 to pick a free port; Tunnel.LocalAddr reports it.
+	LocalAddr string
+
+	// GracePeriod is how long Close waits for active connections to finish
+	// before closing them (default: 5s, negative: close immediately)
+	GracePeriod time.Duration
+
+	// IdleTimeout closes sessions that have seen no data in either
+	// direction for this long (default: 60s for UDP, none for TCP)
+	IdleTimeout time.Duration
+
+	// Limits caps the bandwidth and number of concurrent sessions
+	Limits TunnelLimits
 }
 
+// defaultTunnelGracePeriod is used when TunnelConfig.GracePeriod is zero
+const defaultTunnelGracePeriod = 5 * time.Second
+
+// unixAddrPrefix marks a TunnelConfig.LocalAddr as a Unix socket path
+const unixAddrPrefix = "unix:"
+
 // validate checks if the tunnel configuration is valid
 func (tc *TunnelConfig) validate() error {
-	if tc.LocalPort <= 0 || tc.LocalPort > 65535 {
+	if tc.LocalPort < 0 || tc.LocalPort > 65535 {
 		return errors.New("invalid local port")
 	}
 
@@ -46,6 +91,14 @@ func (tc *TunnelConfig) validate() error {
 		return errors.New("remote peer cannot be empty")
 	}
 
+	if _, _, err := net.SplitHostPort(tc.RemoteHost); err == nil {
+		return errors.New("remote host must not include a port")
+	}
+
+	if tc.RemoteHost == "" {
+		tc.RemoteHost = "localhost"
+	}
+
 	if tc.Protocol == "" {
 		tc.Protocol = ProtocolTCP
 	}
@@ -53,84 +106,350 @@ func (tc *TunnelConfig) validate() error {
 	validProtocols := map[Protocol]bool{
 		ProtocolTCP:  true,
 		ProtocolQUIC: true,
+		ProtocolUDP:  true,
 	}
 
 	if !validProtocols[tc.Protocol] {
 		return fmt.Errorf("invalid protocol: %s", tc.Protocol)
 	}
 
+	if network, address := tc.listenAddress(); network == "unix" {
+		if address == "" {
+			return errors.New("unix socket path cannot be empty")
+		}
+		if tc.Protocol == ProtocolUDP {
+			return errors.New("unix sockets are only supported for TCP tunnels")
+		}
+	}
+
+	if tc.GracePeriod == 0 {
+		tc.GracePeriod = defaultTunnelGracePeriod
+	}
+
+	if tc.IdleTimeout < 0 {
+		return errors.New("idle timeout cannot be negative")
+	}
+
+	if tc.IdleTimeout == 0 && tc.Protocol == ProtocolUDP {
+		tc.IdleTimeout = defaultUDPIdleTimeout
+	}
+
+	if err := tc.Limits.validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// listenAddress returns the network and address of the local listener
+func (tc *TunnelConfig) listenAddress() (string, string) {
+	if path, ok := strings.CutPrefix(tc.LocalAddr, unixAddrPrefix); ok {
+		return "unix", path
+	}
+
+	network := "tcp"
+	if tc.Protocol == ProtocolUDP {
+		network = "udp"
+	}
+	return network, net.JoinHostPort(tc.LocalAddr, strconv.Itoa(tc.LocalPort))
+}
+
 // tunnel implements the Tunnel interface
 type tunnel struct {
-	config TunnelConfig
-	client *Client
-	mu     sync.RWMutex
-	closed bool
+	config   TunnelConfig
+	client   *Client
+	mu       sync.RWMutex
+	closed   bool
+	listener io.Closer // net.Listener, net.PacketConn for UDP, or reverseListener
+	addr     net.Addr  // bound address of the local listener
+	reverse  bool      // forwards connections accepted by the remote peer
+
+	closeOnce sync.Once
+	closeErr  error
+
+	// ctx is cancelled when the tunnel closes
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Active forwarded connections by session ID, and UDP flows by
+	// source address
+	active   map[uint64]*tunnelSession
+	flows    map[string]*udpFlow
+	nextID   uint64
+	counters *tunnelCounters
+	limiter  *tunnelLimiter
+	wg       sync.WaitGroup
+
+	// All forwarded connections share one session to the remote peer
+	sessionMu sync.Mutex
+	session   *session
 }
 
 // start starts the tunnel
 func (t *tunnel) start(ctx context.Context) error {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", t.config.LocalPort))
+	t.active = make(map[uint64]*tunnelSession)
+	t.counters = newTunnelCounters()
+	t.limiter = newTunnelLimiter(t.config.Limits)
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+
+	if t.reverse {
+		return t.startReverse(ctx)
+	}
+
+	if t.config.Protocol == ProtocolUDP {
+		return t.startUDP()
+	}
+
+	var listener net.Listener
+	var err error
+	if network, address := t.config.listenAddress(); network == "unix" {
+		listener, err = listenUnix(address)
+	} else {
+		listener, err = net.Listen(network, address)
+	}
 	if err != nil {
+		t.cancel()
 		return fmt.Errorf("failed to start listener: %w", err)
 	}
+	t.listener = listener
+	t.bound(listener.Addr())
 
-	go func() {
-		defer listener.Close()
-		for {
+	t.wg.Add(1)
+	go t.acceptLoop(listener)
+
+	return nil
+}
+
+// bound records the listener address, and the port picked for LocalPort 0
+func (t *tunnel) bound(addr net.Addr) {
+	t.addr = addr
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		t.config.LocalPort = a.Port
+	case *net.UDPAddr:
+		t.config.LocalPort = a.Port
+	}
+}
+
+// listenUnix listens on a Unix socket at path that only the owner may
+// connect to. The socket is created in a private directory next to path
+// and only moved into place once its mode is 0600, so it is never
+// reachable with the permissions the umask would give it.
+func listenUnix(path string) (net.Listener, error) {
+	if _, err := os.Lstat(path); err == nil {
+		return nil, fmt.Errorf("listen unix %s: address already in use", path)
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".cb")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	private := filepath.Join(dir, "s")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: private, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// The socket is moved, so it is removed by its final path on Close
+	listener.SetUnlinkOnClose(false)
+
+	if err := os.Chmod(private, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	if err := os.Rename(private, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return &unixListener{UnixListener: listener, addr: &net.UnixAddr{Name: path, Net: "unix"}}, nil
+}
+
+// unixListener is a Unix socket listener moved to addr, which it removes
+// on Close
+type unixListener struct {
+	*net.UnixListener
+	addr *net.UnixAddr
+}
+
+// Addr returns the path the socket was moved to
+func (l *unixListener) Addr() net.Addr {
+	return l.addr
+}
+
+// Close stops listening and removes the socket
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	os.Remove(l.addr.Name)
+	return err
+}
+
+// acceptLoop accepts local connections until the listener is closed
+func (t *tunnel) acceptLoop(listener net.Listener) {
+	defer t.wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
 			t.mu.RLock()
-			if t.closed {
-				t.mu.RUnlock()
-				return
-			}
+			closed := t.closed
 			t.mu.RUnlock()
-
-			conn, err := listener.Accept()
-			if err != nil {
-				if !t.closed {
-					fmt.Printf("failed to accept connection: %v\n", err)
-				}
-				return
+			if !closed {
+				t.counters.recordError(TunnelErrorAccept)
+				fmt.Printf("failed to accept connection: %v\n", err)
 			}
+			return
+		}
 
-			go t.handleConnection(ctx, conn)
+		clientAddr := "unknown"
+		if addr := conn.RemoteAddr(); addr != nil && addr.String() != "" {
+			clientAddr = addr.String()
 		}
-	}()
 
-	return nil
+		// Waiting for a slot holds back further connections in the backlog
+		s := t.admit(conn, clientAddr, true)
+		if s == nil {
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			defer t.untrack(s)
+			t.handleConnection(t.ctx, conn, s)
+		}()
+	}
+}
+
+// admit takes a session slot, waiting for one if wait is set and sessions
+// are queued, and tracks the session. It returns nil if the session was
+// rejected or the tunnel is closed.
+func (t *tunnel) admit(conn io.Closer, clientAddr string, wait bool) *tunnelSession {
+	if !t.limiter.acquire(t.ctx, wait) {
+		if t.ctx.Err() == nil {
+			t.counters.recordError(TunnelErrorLimit)
+			fmt.Printf("rejected connection from %s: %d sessions already active\n", clientAddr, t.config.Limits.MaxSessions)
+		}
+		return nil
+	}
+
+	s := t.track(conn, clientAddr)
+	if s == nil {
+		t.limiter.release()
+	}
+	return s
+}
+
+// track registers a session for a forwarded connection from clientAddr.
+// It returns nil if the tunnel is closed.
+func (t *tunnel) track(conn io.Closer, clientAddr string) *tunnelSession {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+
+	t.nextID++
+	s := &tunnelSession{
+		id:         t.nextID,
+		conn:       conn,
+		clientAddr: clientAddr,
+		startedAt:  time.Now(),
+	}
+	t.active[s.id] = s
+	t.counters.totalSessions.Add(1)
+	t.wg.Add(1)
+	return s
 }
 
-func (t *tunnel) handleConnection(ctx context.Context, localConn net.Conn) {
+// untrack removes a finished session
+func (t *tunnel) untrack(s *tunnelSession) {
+	t.mu.Lock()
+	delete(t.active, s.id)
+	t.mu.Unlock()
+
+	t.limiter.release()
+	t.wg.Done()
+}
+
+func (t *tunnel) handleConnection(ctx context.Context, localConn net.Conn, s *tunnelSession) {
 	defer localConn.Close()
 
-	remoteConn, err := t.client.Connect(ctx, t.config.RemotePeer)
+	remoteConn, err := t.openTarget(ctx, StreamKindTunnel, nil)
 	if err != nil {
-		fmt.Printf("failed to connect to remote peer: %v\n", err)
 		return
 	}
 	defer remoteConn.Close()
 
-	// Send handshake
-	handshake := fmt.Sprintf(`{"type":"tunnel","port":%d}`, t.config.RemotePort)
-	if _, err := remoteConn.Write([]byte(handshake)); err != nil {
-		fmt.Printf("failed to send handshake: %v\n", err)
-		return
+	// Bidirectional copy, counting bytes per session and per tunnel
+	out := countingWriter{remoteConn, []*atomic.Int64{&s.bytesOut, &t.counters.bytesOut}}
+	in := countingWriter{localConn, []*atomic.Int64{&s.bytesIn, &t.counters.bytesIn}}
+
+	err = relay(ctx, localConn, remoteConn, out, in, t.limiter.session(t.config.IdleTimeout))
+	if err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, context.Canceled) {
+		t.counters.recordError(TunnelErrorTransfer)
 	}
+}
 
-	// Bidirectional copy
-	errChan := make(chan error, 2)
-	go func() {
-		_, err := io.Copy(remoteConn, localConn)
-		errChan <- err
-	}()
-	go func() {
-		_, err := io.Copy(localConn, remoteConn)
-		errChan <- err
-	}()
+// openTarget opens a stream to the remote peer and asks it to connect the
+// stream to the remote host and port. Failures are logged and counted.
+func (t *tunnel) openTarget(ctx context.Context, kind StreamKind, options map[string]string) (Connection, error) {
+	stream, err := t.openStream(ctx)
+	if err != nil {
+		t.counters.recordError(TunnelErrorConnect)
+		fmt.Printf("failed to connect to remote peer: %v\n", err)
+		return nil, err
+	}
+
+	hsCtx, cancel := context.WithTimeout(ctx, t.client.config.Timeout)
+	defer cancel()
 
-	<-errChan
+	target := net.JoinHostPort(t.config.RemoteHost, strconv.Itoa(t.config.RemotePort))
+	err = handshake(hsCtx, stream, handshakeRequest{
+		Kind:     kind,
+		Target:   target,
+		Metadata: t.client.handshakeMetadata(),
+		Options:  options,
+	})
+	if err != nil {
+		stream.Close()
+		t.counters.recordError(TunnelErrorHandshake)
+		fmt.Printf("tunnel to %s via %s failed: %v\n", target, t.config.RemotePeer, err)
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// openStream opens a stream to the remote peer, dialing a new session
+// if there is none or the previous one has failed. The dial runs without
+// holding sessionMu so one unreachable peer cannot stall every other
+// connection; if two connections dial at once, the first session wins.
+func (t *tunnel) openStream(ctx context.Context) (Connection, error) {
+	t.sessionMu.Lock()
+	s := t.session
+	t.sessionMu.Unlock()
+
+	if s == nil || s.IsClosed() {
+		dialCtx, cancel := context.WithTimeout(ctx, t.client.config.Timeout)
+		dialed, err := t.client.dial(dialCtx, t.config.RemotePeer, false)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		t.sessionMu.Lock()
+		if t.session == nil || t.session.IsClosed() {
+			t.session = dialed
+		} else {
+			dialed.Close()
+		}
+		s = t.session
+		t.sessionMu.Unlock()
+	}
+
+	return s.openStream(ctx)
 }
 
 // RemotePeer returns the remote peer ID
@@ -143,23 +462,73 @@ func (t *tunnel) LocalPort() int {
 	return t.config.LocalPort
 }
 
+// LocalAddr returns the address of the local listener
+func (t *tunnel) LocalAddr() net.Addr {
+	return t.addr
+}
+
+// RemoteHost returns the host the remote peer connects to
+func (t *tunnel) RemoteHost() string {
+	return t.config.RemoteHost
+}
+
 // RemotePort returns the remote port
 func (t *tunnel) RemotePort() int {
 	return t.config.RemotePort
 }
 
-// Close closes the tunnel
+// Close stops accepting connections, waits up to the grace period for
+// active connections to finish, then closes the remaining ones. It returns
+// once all connections and the peer session are released.
 func (t *tunnel) Close() error {
+	t.closeOnce.Do(func() {
+		t.closeErr = t.shutdown()
+	})
+	return t.closeErr
+}
+
+// shutdown releases the tunnel resources
+func (t *tunnel) shutdown() error {
 	t.mu.Lock()
-	defer t.mu.Unlock()
+	t.closed = true
+	t.mu.Unlock()
 
-	if t.closed {
+	if t.listener == nil {
+		// Never started
 		return nil
 	}
 
-	t.closed = true
+	err := t.listener.Close()
 
-	// TODO: Close tunnel resources
+	drained := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(drained)
+	}()
 
-	return nil
+	if t.config.GracePeriod > 0 {
+		timer := time.NewTimer(t.config.GracePeriod)
+		select {
+		case <-drained:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	// Force-close whatever is still running
+	t.cancel()
+	t.mu.Lock()
+	for _, s := range t.active {
+		s.conn.Close()
+	}
+	t.mu.Unlock()
+	<-drained
+
+	t.sessionMu.Lock()
+	if t.session != nil {
+		t.session.Close()
+	}
+	t.sessionMu.Unlock()
+
+	return err
 }
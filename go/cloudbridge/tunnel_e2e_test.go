@@ -0,0 +1,346 @@
+package cloudbridge_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+func TestTunnelEndToEnd(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+	serve(t, network, bob, "bob")
+
+	echoPort := startEchoServer(t)
+	localPort := freePort(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tunnel, err := alice.CreateTunnel(ctx, cloudbridge.TunnelConfig{
+		LocalPort:  localPort,
+		RemotePeer: "bob",
+		RemotePort: echoPort,
+	})
+	if err != nil {
+		t.Fatalf("CreateTunnel() error = %v", err)
+	}
+	defer tunnel.Close()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort)))
+	if err != nil {
+		t.Fatalf("Failed to dial tunnel: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	want := "hello through the tunnel"
+	if _, err := conn.Write([]byte(want)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("ReadFull() error = %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("echo = %q, want %q", got, want)
+	}
+}
+
+// openTunnel creates a tunnel from alice to an echo server on bob and
+// returns it with one established connection through it
+func openTunnel(t *testing.T, gracePeriod time.Duration) (cloudbridge.Tunnel, net.Conn, int) {
+	t.Helper()
+
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+	serve(t, network, bob, "bob")
+
+	localPort := freePort(t)
+	tunnel, err := alice.CreateTunnel(context.Background(), cloudbridge.TunnelConfig{
+		LocalPort:   localPort,
+		RemotePeer:  "bob",
+		RemotePort:  startEchoServer(t),
+		GracePeriod: gracePeriod,
+	})
+	if err != nil {
+		t.Fatalf("CreateTunnel() error = %v", err)
+	}
+	t.Cleanup(func() { tunnel.Close() })
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort)))
+	if err != nil {
+		t.Fatalf("Failed to dial tunnel: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Round-trip once so the connection is known to be forwarded
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+		t.Fatalf("ReadFull() error = %v", err)
+	}
+
+	return tunnel, conn, localPort
+}
+
+func TestTunnelCloseForcesActiveConnections(t *testing.T) {
+	tunnel, conn, localPort := openTunnel(t, 50*time.Millisecond)
+
+	start := time.Now()
+	if err := tunnel.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Close() returned after %v, before the grace period", elapsed)
+	}
+
+	// The forwarded connection was closed by the tunnel
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("Read() on force-closed connection should fail")
+	}
+
+	// The local port is released
+	if _, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort))); err == nil {
+		t.Error("Dial() after Close() should fail")
+	}
+}
+
+func TestTunnelCloseDrainsConnections(t *testing.T) {
+	tunnel, conn, _ := openTunnel(t, 10*time.Second)
+
+	time.AfterFunc(50*time.Millisecond, func() { conn.Close() })
+
+	start := time.Now()
+	if err := tunnel.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Close() took %v, want it to return once connections drained", elapsed)
+	}
+}
+
+func TestTunnelRemoteHost(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+
+	echoPort := startEchoServer(t)
+	bob, err := cloudbridge.NewClient(
+		cloudbridge.WithToken("test-token"),
+		cloudbridge.WithTransport(newTestTransport(network, "bob")),
+		cloudbridge.WithTunnelPolicy(cloudbridge.TunnelPolicy{Rules: []cloudbridge.TunnelRule{
+			{PeerIDs: []string{"alice"}, Targets: []string{net.JoinHostPort("127.0.0.1", strconv.Itoa(echoPort))}},
+		}}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client bob: %v", err)
+	}
+	t.Cleanup(func() { bob.Close() })
+	serve(t, network, bob, "bob")
+
+	tests := []struct {
+		name       string
+		remoteHost string
+		wantDenied bool
+	}{
+		{name: "allowed host", remoteHost: "127.0.0.1", wantDenied: false},
+		{name: "host outside policy", remoteHost: "10.0.0.5", wantDenied: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localPort := freePort(t)
+			tunnel, err := alice.CreateTunnel(context.Background(), cloudbridge.TunnelConfig{
+				LocalPort:  localPort,
+				RemotePeer: "bob",
+				RemoteHost: tt.remoteHost,
+				RemotePort: echoPort,
+			})
+			if err != nil {
+				t.Fatalf("CreateTunnel() error = %v", err)
+			}
+			defer tunnel.Close()
+
+			conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort)))
+			if err != nil {
+				t.Fatalf("Failed to dial tunnel: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			conn.Write([]byte("ping"))
+			_, err = io.ReadFull(conn, make([]byte, 4))
+			if denied := err != nil; denied != tt.wantDenied {
+				t.Errorf("ReadFull() error = %v, wantDenied %v", err, tt.wantDenied)
+			}
+			if tt.wantDenied && tunnel.Stats().Errors[cloudbridge.TunnelErrorHandshake] != 1 {
+				t.Errorf("Errors[handshake] = %d, want 1", tunnel.Stats().Errors[cloudbridge.TunnelErrorHandshake])
+			}
+		})
+	}
+}
+
+// spoofingTransport claims another peer's ID in its handshakes
+type spoofingTransport struct {
+	*memtransport.Transport
+	claim string
+}
+
+// LocalPeerID returns the claimed peer ID
+func (t spoofingTransport) LocalPeerID() string {
+	return t.claim
+}
+
+func TestTunnelPolicySpoofedPeer(t *testing.T) {
+	network := memtransport.NewNetwork()
+
+	echoPort := startEchoServer(t)
+	bob, err := cloudbridge.NewClient(
+		cloudbridge.WithToken("test-token"),
+		cloudbridge.WithTransport(newTestTransport(network, "bob")),
+		cloudbridge.WithTunnelPolicy(cloudbridge.TunnelPolicy{Rules: []cloudbridge.TunnelRule{
+			{PeerIDs: []string{"alice"}, Targets: []string{"localhost:*"}},
+		}}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client bob: %v", err)
+	}
+	t.Cleanup(func() { bob.Close() })
+	serve(t, network, bob, "bob")
+
+	mallory, err := cloudbridge.NewClient(
+		cloudbridge.WithToken("test-token"),
+		cloudbridge.WithTransport(spoofingTransport{network.NewTransport("mallory"), "alice"}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client mallory: %v", err)
+	}
+	t.Cleanup(func() { mallory.Close() })
+
+	tests := []struct {
+		name       string
+		client     *cloudbridge.Client
+		wantDenied bool
+	}{
+		{name: "allowed peer", client: newTestClient(t, network, "alice"), wantDenied: false},
+		{name: "peer claiming an allowed ID", client: mallory, wantDenied: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localPort := freePort(t)
+			tunnel, err := tt.client.CreateTunnel(context.Background(), cloudbridge.TunnelConfig{
+				LocalPort:  localPort,
+				RemotePeer: "bob",
+				RemotePort: echoPort,
+			})
+			if err != nil {
+				t.Fatalf("CreateTunnel() error = %v", err)
+			}
+			defer tunnel.Close()
+
+			conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort)))
+			if err != nil {
+				t.Fatalf("Failed to dial tunnel: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			conn.Write([]byte("ping"))
+			_, err = io.ReadFull(conn, make([]byte, 4))
+			if denied := err != nil; denied != tt.wantDenied {
+				t.Errorf("ReadFull() error = %v, wantDenied %v", err, tt.wantDenied)
+			}
+		})
+	}
+}
+
+func TestTunnelLocalAddr(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+	serve(t, network, bob, "bob")
+
+	echoPort := startEchoServer(t)
+	socketPath := filepath.Join(t.TempDir(), "tunnel.sock")
+
+	tests := []struct {
+		name      string
+		localAddr string
+		wantNet   string
+	}{
+		{name: "loopback with picked port", localAddr: "127.0.0.1", wantNet: "tcp"},
+		{name: "unix socket", localAddr: "unix:" + socketPath, wantNet: "unix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tunnel, err := alice.CreateTunnel(context.Background(), cloudbridge.TunnelConfig{
+				LocalAddr:  tt.localAddr,
+				RemotePeer: "bob",
+				RemotePort: echoPort,
+			})
+			if err != nil {
+				t.Fatalf("CreateTunnel() error = %v", err)
+			}
+			defer tunnel.Close()
+
+			addr := tunnel.LocalAddr()
+			if addr == nil || addr.Network() != tt.wantNet {
+				t.Fatalf("LocalAddr() = %v, want a %s address", addr, tt.wantNet)
+			}
+			if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+				if !tcpAddr.IP.IsLoopback() || tcpAddr.Port == 0 || tunnel.LocalPort() != tcpAddr.Port {
+					t.Errorf("LocalAddr() = %v, LocalPort() = %d, want bound loopback port", addr, tunnel.LocalPort())
+				}
+			}
+			if tt.wantNet == "unix" {
+				if addr.String() != socketPath {
+					t.Errorf("LocalAddr() = %v, want %v", addr, socketPath)
+				}
+				info, err := os.Stat(socketPath)
+				if err != nil {
+					t.Fatalf("Stat() error = %v", err)
+				}
+				if info.Mode().Perm() != 0o600 {
+					t.Errorf("socket mode = %v, want 0600", info.Mode().Perm())
+				}
+			}
+
+			conn, err := net.Dial(addr.Network(), addr.String())
+			if err != nil {
+				t.Fatalf("Failed to dial tunnel: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			if _, err := conn.Write([]byte("ping")); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+				t.Fatalf("ReadFull() error = %v", err)
+			}
+		})
+	}
+
+	// The socket is removed on Close, and nothing else is left behind
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("socket still exists after Close: %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(socketPath)); len(entries) != 0 {
+		t.Errorf("socket directory has %d entries after Close, want none", len(entries))
+	}
+}
@@ -0,0 +1,296 @@
+package cloudbridge
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TunnelLimits caps the bandwidth and concurrency of tunnel sessions.
+// Zero values mean no limit.
+type TunnelLimits struct {
+	// Rate limits the traffic of all sessions together, SessionRate that
+	// of each session
+	Rate        RateLimit
+	SessionRate RateLimit
+
+	// MaxSessions caps the number of concurrent sessions. Further sessions
+	// are rejected, or wait for a free slot when QueueSessions is set.
+	MaxSessions   int
+	QueueSessions bool
+}
+
+// RateLimit is a token bucket limit in bytes per second. Upload is traffic
+// sent to the remote peer, Download traffic received from it. Up to one
+// second of unused allowance can be spent in a burst.
+type RateLimit struct {
+	Upload   int64
+	Download int64
+}
+
+// validate checks if the limits are valid
+func (l TunnelLimits) validate() error {
+	if l.Rate.Upload < 0 || l.Rate.Download < 0 || l.SessionRate.Upload < 0 || l.SessionRate.Download < 0 {
+		return errors.New("rate limits cannot be negative")
+	}
+	if l.MaxSessions < 0 {
+		return errors.New("max sessions cannot be negative")
+	}
+	return nil
+}
+
+// tunnelLimiter enforces TunnelLimits across the sessions of a tunnel,
+// or across all inbound tunnels of a client
+type tunnelLimiter struct {
+	limits   TunnelLimits
+	slots    chan struct{} // nil without MaxSessions
+	up, down *tokenBucket  // shared by all sessions
+}
+
+// newTunnelLimiter creates a limiter for limits
+func newTunnelLimiter(limits TunnelLimits) *tunnelLimiter {
+	l := &tunnelLimiter{
+		limits: limits,
+		up:     newTokenBucket(limits.Rate.Upload),
+		down:   newTokenBucket(limits.Rate.Download),
+	}
+	if limits.MaxSessions > 0 {
+		l.slots = make(chan struct{}, limits.MaxSessions)
+	}
+	return l
+}
+
+// acquire takes a session slot, waiting for one until ctx is done if
+// sessions are queued. It reports whether a slot was taken.
+func (l *tunnelLimiter) acquire(ctx context.Context, wait bool) bool {
+	if l.slots == nil {
+		return true
+	}
+
+	if wait && l.limits.QueueSessions {
+		select {
+		case l.slots <- struct{}{}:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release frees a slot taken by acquire
+func (l *tunnelLimiter) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// session returns the relay limits for a new session
+func (l *tunnelLimiter) session(idleTimeout time.Duration) relayLimits {
+	return relayLimits{
+		up:          []*tokenBucket{l.up, newTokenBucket(l.limits.SessionRate.Upload)},
+		down:        []*tokenBucket{l.down, newTokenBucket(l.limits.SessionRate.Download)},
+		idleTimeout: idleTimeout,
+	}
+}
+
+// relayLimits applies to the traffic of one relayed session
+type relayLimits struct {
+	up, down    []*tokenBucket // nil entries are unlimited
+	idleTimeout time.Duration  // zero for none
+}
+
+// relay copies localConn to out and remoteConn to in until either direction
+// ends, where out writes to the remote side and in to the local side.
+// Without data in either direction for the idle timeout, both connections
+// are closed and relay returns nil. Otherwise it returns the error that
+// ended the first direction.
+func relay(ctx context.Context, localConn, remoteConn io.ReadWriteCloser, out, in io.Writer, limits relayLimits) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var idle *idleTimer
+	if limits.idleTimeout > 0 {
+		idle = newIdleTimer(limits.idleTimeout, func() {
+			localConn.Close()
+			remoteConn.Close()
+		})
+		defer idle.stop()
+		out = activityWriter{out, idle}
+		in = activityWriter{in, idle}
+	}
+
+	out = limitedWriter{ctx, out, limits.up}
+	in = limitedWriter{ctx, in, limits.down}
+
+	errChan := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(out, localConn)
+		errChan <- err
+	}()
+	go func() {
+		_, err := io.Copy(in, remoteConn)
+		errChan <- err
+	}()
+
+	err := <-errChan
+	if idle != nil && idle.expired.Load() {
+		return nil
+	}
+	return err
+}
+
+// tokenBucket limits a byte rate. Callers take the tokens they need up
+// front and wait off any resulting debt, so writes larger than the bucket
+// still pass at the configured rate.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket for rate bytes per second, or nil
+// if rate is zero
+func newTokenBucket(rate int64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// wait takes n tokens, blocking until the bucket has covered them or ctx
+// is done
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limitedWriter waits for the buckets before each write. Writes are split
+// into chunks of at most one burst so that traffic stays smooth.
+type limitedWriter struct {
+	ctx     context.Context
+	w       io.Writer
+	buckets []*tokenBucket
+}
+
+func (l limitedWriter) Write(b []byte) (int, error) {
+	chunk := len(b)
+	for _, bucket := range l.buckets {
+		if bucket != nil && int(bucket.burst) < chunk {
+			chunk = max(int(bucket.burst), 1)
+		}
+	}
+
+	written := 0
+	for written < len(b) {
+		p := b[written:min(written+chunk, len(b))]
+		if err := waitBuckets(l.ctx, l.buckets, len(p)); err != nil {
+			return written, err
+		}
+
+		n, err := l.w.Write(p)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// waitBuckets takes n tokens from each bucket in turn
+func waitBuckets(ctx context.Context, buckets []*tokenBucket, n int) error {
+	for _, bucket := range buckets {
+		if bucket == nil {
+			continue
+		}
+		if err := bucket.wait(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// idleTimer calls onIdle once no activity has been recorded for timeout
+type idleTimer struct {
+	timeout    time.Duration
+	onIdle     func()
+	lastActive atomic.Int64
+	expired    atomic.Bool
+	timer      *time.Timer
+}
+
+// newIdleTimer starts an idle timer
+func newIdleTimer(timeout time.Duration, onIdle func()) *idleTimer {
+	t := &idleTimer{timeout: timeout, onIdle: onIdle}
+	t.touch()
+	t.timer = time.AfterFunc(timeout, t.check)
+	return t
+}
+
+// touch records activity
+func (t *idleTimer) touch() {
+	t.lastActive.Store(time.Now().UnixNano())
+}
+
+// check fires onIdle if the timer has been idle for the timeout, and
+// otherwise waits for the rest of it
+func (t *idleTimer) check() {
+	idle := time.Since(time.Unix(0, t.lastActive.Load()))
+	if idle >= t.timeout {
+		t.expired.Store(true)
+		t.onIdle()
+		return
+	}
+	t.timer.Reset(t.timeout - idle)
+}
+
+// stop stops the timer
+func (t *idleTimer) stop() {
+	t.timer.Stop()
+}
+
+// activityWriter records each write on an idle timer
+type activityWriter struct {
+	w    io.Writer
+	idle *idleTimer
+}
+
+func (a activityWriter) Write(b []byte) (int, error) {
+	a.idle.touch()
+	return a.w.Write(b)
+}
@@ -0,0 +1,188 @@
+package cloudbridge_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+// limitedTunnel creates a tunnel from alice to an echo server on bob,
+// which is created with opts
+func limitedTunnel(t *testing.T, config cloudbridge.TunnelConfig, opts ...cloudbridge.Option) cloudbridge.Tunnel {
+	t.Helper()
+
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob, err := cloudbridge.NewClient(append([]cloudbridge.Option{
+		cloudbridge.WithToken("test-token"),
+		cloudbridge.WithTransport(newTestTransport(network, "bob")),
+	}, opts...)...)
+	if err != nil {
+		t.Fatalf("Failed to create client bob: %v", err)
+	}
+	t.Cleanup(func() { bob.Close() })
+	serve(t, network, bob, "bob")
+
+	config.LocalAddr = "127.0.0.1"
+	config.RemotePeer = "bob"
+	config.RemotePort = startEchoServer(t)
+	tunnel, err := alice.CreateTunnel(context.Background(), config)
+	if err != nil {
+		t.Fatalf("CreateTunnel() error = %v", err)
+	}
+	t.Cleanup(func() { tunnel.Close() })
+
+	return tunnel
+}
+
+// echo dials the tunnel and round-trips data through it
+func echo(t *testing.T, tunnel cloudbridge.Tunnel, data []byte) (net.Conn, error) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", tunnel.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial tunnel: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	go conn.Write(data)
+	_, err = io.ReadFull(conn, make([]byte, len(data)))
+	return conn, err
+}
+
+func TestTunnelMaxSessions(t *testing.T) {
+	tests := []struct {
+		name  string
+		queue bool
+	}{
+		{name: "reject", queue: false},
+		{name: "queue", queue: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tunnel := limitedTunnel(t, cloudbridge.TunnelConfig{
+				Limits: cloudbridge.TunnelLimits{MaxSessions: 1, QueueSessions: tt.queue},
+			})
+
+			first, err := echo(t, tunnel, []byte("ping"))
+			if err != nil {
+				t.Fatalf("first session error = %v", err)
+			}
+
+			if tt.queue {
+				time.AfterFunc(100*time.Millisecond, func() { first.Close() })
+			}
+
+			_, err = echo(t, tunnel, []byte("ping"))
+			if rejected := err != nil; rejected == tt.queue {
+				t.Errorf("second session error = %v, want rejected %v", err, !tt.queue)
+			}
+			wantRejected := int64(1)
+			if tt.queue {
+				wantRejected = 0
+			}
+			if got := tunnel.Stats().Errors[cloudbridge.TunnelErrorLimit]; got != wantRejected {
+				t.Errorf("Errors[limit] = %d, want %d", got, wantRejected)
+			}
+		})
+	}
+}
+
+func TestInboundTunnelLimits(t *testing.T) {
+	tunnel := limitedTunnel(t, cloudbridge.TunnelConfig{},
+		cloudbridge.WithInboundTunnelLimits(cloudbridge.TunnelLimits{MaxSessions: 1}))
+
+	if _, err := echo(t, tunnel, []byte("ping")); err != nil {
+		t.Fatalf("first session error = %v", err)
+	}
+	if _, err := echo(t, tunnel, []byte("ping")); err == nil {
+		t.Error("second session error = nil, want rejected by the remote peer")
+	}
+	waitFor(t, "handshake error", func() bool {
+		return tunnel.Stats().Errors[cloudbridge.TunnelErrorHandshake] == 1
+	})
+}
+
+func TestTunnelRateLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		config cloudbridge.TunnelConfig
+		opts   []cloudbridge.Option
+	}{
+		{
+			name:   "tunnel upload",
+			config: cloudbridge.TunnelConfig{Limits: cloudbridge.TunnelLimits{Rate: cloudbridge.RateLimit{Upload: 16 << 10}}},
+		},
+		{
+			name:   "session download",
+			config: cloudbridge.TunnelConfig{Limits: cloudbridge.TunnelLimits{SessionRate: cloudbridge.RateLimit{Download: 16 << 10}}},
+		},
+		{
+			name: "inbound upload",
+			opts: []cloudbridge.Option{cloudbridge.WithInboundTunnelLimits(cloudbridge.TunnelLimits{
+				SessionRate: cloudbridge.RateLimit{Upload: 16 << 10},
+			})},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tunnel := limitedTunnel(t, tt.config, tt.opts...)
+
+			// One second of burst, then one second at the limit
+			start := time.Now()
+			if _, err := echo(t, tunnel, make([]byte, 32<<10)); err != nil {
+				t.Fatalf("echo error = %v", err)
+			}
+			if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+				t.Errorf("32KiB at 16KiB/s took %v, want about 1s", elapsed)
+			}
+		})
+	}
+}
+
+func TestTunnelIdleTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		config cloudbridge.TunnelConfig
+		opts   []cloudbridge.Option
+	}{
+		{
+			name:   "tunnel",
+			config: cloudbridge.TunnelConfig{IdleTimeout: 100 * time.Millisecond},
+		},
+		{
+			name: "inbound",
+			opts: []cloudbridge.Option{cloudbridge.WithInboundIdleTimeout(100 * time.Millisecond)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tunnel := limitedTunnel(t, tt.config, tt.opts...)
+
+			conn, err := echo(t, tunnel, []byte("ping"))
+			if err != nil {
+				t.Fatalf("echo error = %v", err)
+			}
+
+			start := time.Now()
+			if _, err := conn.Read(make([]byte, 1)); err == nil {
+				t.Error("Read() on idle connection should fail")
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("idle connection closed after %v, want about 100ms", elapsed)
+			}
+			waitFor(t, "session to end", func() bool {
+				return tunnel.Stats().ActiveSessions == 0
+			})
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package cloudbridge
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(100 << 10)
+	ctx := context.Background()
+
+	// The first second of allowance passes at once
+	start := time.Now()
+	if err := bucket.wait(ctx, 100<<10); err != nil {
+		t.Fatalf("wait() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("wait() within burst took %v", elapsed)
+	}
+
+	// Further bytes are paced at the rate
+	start = time.Now()
+	if err := bucket.wait(ctx, 20<<10); err != nil {
+		t.Fatalf("wait() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("wait() over burst took %v, want about 200ms", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := bucket.wait(cancelled, 100<<10); err == nil {
+		t.Error("wait() with cancelled context error = nil, want error")
+	}
+
+	if newTokenBucket(0) != nil {
+		t.Error("newTokenBucket(0) should be unlimited")
+	}
+}
+
+func TestLimitedWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := limitedWriter{context.Background(), &buf, []*tokenBucket{nil, newTokenBucket(10 << 10)}}
+
+	start := time.Now()
+	data := bytes.Repeat([]byte("x"), 15<<10)
+	n, err := w.Write(data)
+	if err != nil || n != len(data) {
+		t.Fatalf("Write() = %d, %v, want %d, nil", n, err, len(data))
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("Write() took %v, want about 500ms", elapsed)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Error("Write() did not pass the data through unchanged")
+	}
+}
+
+func TestTunnelLimiterAcquire(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits TunnelLimits
+		want   []bool
+	}{
+		{
+			name:   "unlimited",
+			limits: TunnelLimits{},
+			want:   []bool{true, true, true},
+		},
+		{
+			name:   "reject over limit",
+			limits: TunnelLimits{MaxSessions: 2},
+			want:   []bool{true, true, false},
+		},
+		{
+			name:   "queue over limit",
+			limits: TunnelLimits{MaxSessions: 1, QueueSessions: true},
+			want:   []bool{true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTunnelLimiter(tt.limits)
+
+			// A queued acquire gives up when its context ends
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			for i, want := range tt.want {
+				if got := l.acquire(ctx, true); got != want {
+					t.Errorf("acquire() #%d = %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("queued acquire gets released slot", func(t *testing.T) {
+		l := newTunnelLimiter(TunnelLimits{MaxSessions: 1, QueueSessions: true})
+		l.acquire(context.Background(), true)
+
+		time.AfterFunc(20*time.Millisecond, l.release)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if !l.acquire(ctx, true) {
+			t.Error("acquire() = false after release, want true")
+		}
+		if l.acquire(ctx, false) {
+			t.Error("acquire() without waiting = true, want false")
+		}
+	})
+}
+
+func TestRelayIdleTimeout(t *testing.T) {
+	local, localPeer := net.Pipe()
+	remote, remotePeer := net.Pipe()
+	defer localPeer.Close()
+	defer remotePeer.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- relay(context.Background(), local, remote, remote, local, relayLimits{idleTimeout: 100 * time.Millisecond})
+	}()
+
+	// Traffic keeps the relay open past the timeout
+	for i := 0; i < 3; i++ {
+		time.Sleep(50 * time.Millisecond)
+		go localPeer.Write([]byte("ping"))
+		if _, err := io.ReadFull(remotePeer, make([]byte, 4)); err != nil {
+			t.Fatalf("relay did not forward data: %v", err)
+		}
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("relay() error = %v, want nil after idle timeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not close after idle timeout")
+	}
+
+	if _, err := localPeer.Read(make([]byte, 1)); err == nil {
+		t.Error("local connection still open after idle timeout")
+	}
+}
@@ -0,0 +1,282 @@
+package cloudbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/yamux"
+)
+
+// ReverseTunnelConfig holds configuration for a reverse tunnel
+type ReverseTunnelConfig struct {
+	// RemotePeer is the peer that listens on RemotePort
+	RemotePeer string
+	RemotePort int
+
+	// LocalPort receives the connections accepted by the remote peer
+	LocalPort int
+
+	// GracePeriod is how long Close waits for active connections to finish
+	// before closing them (default: 5s, negative: close immediately)
+	GracePeriod time.Duration
+
+	// IdleTimeout closes connections that have seen no data in either
+	// direction for this long (default: none)
+	IdleTimeout time.Duration
+
+	// Limits caps the bandwidth and number of concurrent connections
+	Limits TunnelLimits
+}
+
+// CreateReverseTunnel asks the remote peer to listen on RemotePort and
+// forward each accepted connection back to LocalPort on this machine.
+// The remote peer must be running Serve. The tunnel's Stats report
+// the remote client address of each session.
+//
+// A reverse tunnel stops when its session to the remote peer fails;
+// it does not reconnect.
+func (c *Client) CreateReverseTunnel(ctx context.Context, config ReverseTunnelConfig) (Tunnel, error) {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return nil, errors.New("client is closed")
+	}
+	c.mu.RUnlock()
+
+	if config.LocalPort <= 0 || config.LocalPort > 65535 {
+		return nil, errors.New("invalid tunnel configuration: invalid local port")
+	}
+
+	tunnelConfig := TunnelConfig{
+		LocalPort:   config.LocalPort,
+		RemotePeer:  config.RemotePeer,
+		RemotePort:  config.RemotePort,
+		Protocol:    ProtocolTCP,
+		GracePeriod: config.GracePeriod,
+		IdleTimeout: config.IdleTimeout,
+		Limits:      config.Limits,
+	}
+	if err := tunnelConfig.validate(); err != nil {
+		return nil, fmt.Errorf("invalid tunnel configuration: %w", err)
+	}
+
+	tunnel := &tunnel{
+		config:  tunnelConfig,
+		client:  c,
+		reverse: true,
+	}
+
+	if err := tunnel.start(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create tunnel: %w", err)
+	}
+
+	return tunnel, nil
+}
+
+// startReverse asks the remote peer to bind the remote port. The request
+// stream then carries a session on which the remote peer opens a stream
+// per accepted connection.
+func (t *tunnel) startReverse(ctx context.Context) error {
+	c := t.client
+
+	hsCtx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	stream, err := c.openHandshakeStream(hsCtx, t.config.RemotePeer, StreamKindReverse,
+		net.JoinHostPort("", strconv.Itoa(t.config.RemotePort)))
+	if err != nil {
+		t.cancel()
+		return err
+	}
+
+	mux, err := yamux.Server(stream, muxConfig())
+	if err != nil {
+		stream.Close()
+		t.cancel()
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+
+	s := &session{
+		peerID:      t.config.RemotePeer,
+		localPeerID: c.transport.LocalPeerID(),
+		client:      c,
+		mux:         mux,
+	}
+	c.sessions.add(s)
+
+	acceptCtx, stop := context.WithCancel(t.ctx)
+	t.listener = reverseListener{mux: mux, stop: stop}
+	t.session = s
+
+	t.wg.Add(1)
+	go t.reverseLoop(acceptCtx, s)
+
+	return nil
+}
+
+// reverseListener stops a reverse tunnel from taking new connections
+type reverseListener struct {
+	mux  *yamux.Session
+	stop context.CancelFunc
+}
+
+// Close tells the remote peer to stop forwarding connections.
+// Streams already open are not affected.
+func (l reverseListener) Close() error {
+	l.stop()
+	return l.mux.GoAway()
+}
+
+// reverseLoop accepts the streams opened by the remote peer
+func (t *tunnel) reverseLoop(ctx context.Context, s *session) {
+	defer t.wg.Done()
+
+	for {
+		stream, err := s.acceptStream(ctx)
+		if err != nil {
+			t.mu.RLock()
+			closed := t.closed
+			t.mu.RUnlock()
+			if !closed {
+				t.counters.recordError(TunnelErrorAccept)
+				fmt.Printf("reverse tunnel from %s:%d stopped: %v\n", t.config.RemotePeer, t.config.RemotePort, err)
+			}
+			return
+		}
+
+		go t.handleReverse(stream)
+	}
+}
+
+// handleReverse forwards one connection accepted by the remote peer to the
+// local port
+func (t *tunnel) handleReverse(remoteConn Connection) {
+	defer remoteConn.Close()
+
+	// The remote peer announces the client address first
+	remoteConn.SetReadDeadline(time.Now().Add(t.client.config.Timeout))
+	clientAddr, _, err := readFrame(remoteConn, maxHandshakeSize)
+	if err != nil {
+		t.counters.recordError(TunnelErrorHandshake)
+		return
+	}
+	remoteConn.SetReadDeadline(time.Time{})
+
+	s := t.admit(remoteConn, string(clientAddr), true)
+	if s == nil {
+		return
+	}
+	defer t.untrack(s)
+
+	target := net.JoinHostPort("localhost", strconv.Itoa(t.config.LocalPort))
+	localConn, err := net.DialTimeout("tcp", target, t.client.config.Timeout)
+	if err != nil {
+		t.counters.recordError(TunnelErrorConnect)
+		fmt.Printf("failed to connect to %s: %v\n", target, err)
+		return
+	}
+	defer localConn.Close()
+
+	out := countingWriter{remoteConn, []*atomic.Int64{&s.bytesOut, &t.counters.bytesOut}}
+	in := countingWriter{localConn, []*atomic.Int64{&s.bytesIn, &t.counters.bytesIn}}
+
+	err = relay(t.ctx, localConn, remoteConn, out, in, t.limiter.session(t.config.IdleTimeout))
+	if err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, context.Canceled) {
+		t.counters.recordError(TunnelErrorTransfer)
+	}
+}
+
+// serveReverse binds the port requested by a reverse tunnel on the policy's
+// listen host and streams accepted connections back over a session on the
+// request stream. Each reverse tunnel counts as one inbound session. peerID
+// is the requesting peer. It blocks until that peer closes the tunnel.
+func (c *Client) serveReverse(stream io.ReadWriteCloser, req handshakeRequest, peerID string) {
+	host, port, err := net.SplitHostPort(req.Target)
+	if err != nil || host != "" {
+		rejectHandshake(stream, HandshakeBadRequest, fmt.Sprintf("invalid listen address %q", req.Target))
+		return
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n <= 0 || n > 65535 {
+		rejectHandshake(stream, HandshakeBadRequest, fmt.Sprintf("invalid listen port %q", port))
+		return
+	}
+	if !c.checkListenPort(stream, peerID, n) {
+		return
+	}
+
+	if !c.admitInbound(stream) {
+		return
+	}
+	defer c.inbound.release()
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(c.listenHost(), port))
+	if err != nil {
+		rejectHandshake(stream, HandshakeInternalError, err.Error())
+		return
+	}
+	defer listener.Close()
+
+	if err := writeHandshakeResponse(stream, HandshakeOK, ""); err != nil {
+		fmt.Printf("failed to acknowledge reverse tunnel: %v\n", err)
+		return
+	}
+
+	mux, err := yamux.Client(stream, muxConfig())
+	if err != nil {
+		fmt.Printf("failed to start session: %v\n", err)
+		return
+	}
+	defer mux.Close()
+
+	// Stop listening once the requesting peer goes away
+	go func() {
+		<-mux.CloseChan()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		remoteConn, err := mux.OpenStream()
+		if err != nil {
+			conn.Close()
+			if errors.Is(err, yamux.ErrRemoteGoAway) {
+				// The tunnel is closing; refuse further connections but
+				// keep the session until active ones have drained
+				listener.Close()
+				<-mux.CloseChan()
+				return
+			}
+			if mux.IsClosed() {
+				return
+			}
+			continue
+		}
+
+		go c.forwardReverse(conn, muxStream{remoteConn})
+	}
+}
+
+// forwardReverse relays between a connection accepted for a reverse tunnel
+// and its stream to the requesting peer, under the inbound tunnel limits
+func (c *Client) forwardReverse(conn net.Conn, stream io.ReadWriteCloser) {
+	defer conn.Close()
+	defer stream.Close()
+
+	if _, err := writeFrame(stream, []byte(conn.RemoteAddr().String())); err != nil {
+		return
+	}
+
+	limits := c.inbound.session(c.config.InboundIdleTimeout)
+	relay(context.Background(), conn, stream, stream, conn, limits)
+}
@@ -0,0 +1,236 @@
+package cloudbridge_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+func TestReverseTunnel(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+
+	// Bob listens on remotePort and forwards back to alice's echo server
+	remotePort := freePort(t)
+	bob, err := cloudbridge.NewClient(
+		cloudbridge.WithToken("test-token"),
+		cloudbridge.WithTransport(newTestTransport(network, "bob")),
+		cloudbridge.WithTunnelPolicy(cloudbridge.TunnelPolicy{Rules: []cloudbridge.TunnelRule{
+			{PeerIDs: []string{"alice"}, ListenPorts: []int{remotePort}},
+		}}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client bob: %v", err)
+	}
+	t.Cleanup(func() { bob.Close() })
+	serve(t, network, bob, "bob")
+
+	tunnel, err := alice.CreateReverseTunnel(context.Background(), cloudbridge.ReverseTunnelConfig{
+		RemotePeer: "bob",
+		RemotePort: remotePort,
+		LocalPort:  startEchoServer(t),
+	})
+	if err != nil {
+		t.Fatalf("CreateReverseTunnel() error = %v", err)
+	}
+	defer tunnel.Close()
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(remotePort))
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to dial reverse tunnel: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("ReadFull() error = %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("ReadFull() = %q, want %q", buf, "ping")
+	}
+
+	stats := tunnel.Stats()
+	if len(stats.Sessions) != 1 || stats.Sessions[0].ClientAddr != conn.LocalAddr().String() {
+		t.Errorf("Stats().Sessions = %+v, want one session from %v", stats.Sessions, conn.LocalAddr())
+	}
+
+	// A second reverse tunnel cannot bind the same port
+	_, err = alice.CreateReverseTunnel(context.Background(), cloudbridge.ReverseTunnelConfig{
+		RemotePeer: "bob",
+		RemotePort: remotePort,
+		LocalPort:  startEchoServer(t),
+	})
+	var hsErr *cloudbridge.HandshakeError
+	if !errors.As(err, &hsErr) {
+		t.Errorf("CreateReverseTunnel() on bound port error = %v, want HandshakeError", err)
+	}
+
+	conn.Close()
+	if err := tunnel.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Bob releases the port
+	waitFor(t, "remote port to be released", func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return true
+		}
+		conn.Close()
+		return false
+	})
+}
+
+func TestReverseTunnelWithoutPolicy(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+	serve(t, network, bob, "bob")
+
+	_, err := alice.CreateReverseTunnel(context.Background(), cloudbridge.ReverseTunnelConfig{
+		RemotePeer: "bob",
+		RemotePort: freePort(t),
+		LocalPort:  startEchoServer(t),
+	})
+	var hsErr *cloudbridge.HandshakeError
+	if !errors.As(err, &hsErr) || hsErr.Code != cloudbridge.HandshakeForbidden {
+		t.Errorf("CreateReverseTunnel() error = %v, want HandshakeForbidden", err)
+	}
+}
+
+func TestReverseTunnelInboundLimits(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+
+	ports := []int{freePort(t), freePort(t)}
+	bob, err := cloudbridge.NewClient(
+		cloudbridge.WithToken("test-token"),
+		cloudbridge.WithTransport(newTestTransport(network, "bob")),
+		cloudbridge.WithTunnelPolicy(cloudbridge.TunnelPolicy{Rules: []cloudbridge.TunnelRule{
+			{PeerIDs: []string{"alice"}, ListenPorts: ports},
+		}}),
+		cloudbridge.WithInboundTunnelLimits(cloudbridge.TunnelLimits{MaxSessions: 1}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client bob: %v", err)
+	}
+	t.Cleanup(func() { bob.Close() })
+	serve(t, network, bob, "bob")
+
+	localPort := startEchoServer(t)
+	tunnel, err := alice.CreateReverseTunnel(context.Background(), cloudbridge.ReverseTunnelConfig{
+		RemotePeer: "bob",
+		RemotePort: ports[0],
+		LocalPort:  localPort,
+	})
+	if err != nil {
+		t.Fatalf("CreateReverseTunnel() error = %v", err)
+	}
+	defer tunnel.Close()
+
+	// The first reverse tunnel holds the only inbound session
+	_, err = alice.CreateReverseTunnel(context.Background(), cloudbridge.ReverseTunnelConfig{
+		RemotePeer: "bob",
+		RemotePort: ports[1],
+		LocalPort:  localPort,
+	})
+	var hsErr *cloudbridge.HandshakeError
+	if !errors.As(err, &hsErr) || hsErr.Code != cloudbridge.HandshakeBusy {
+		t.Errorf("second CreateReverseTunnel() error = %v, want HandshakeBusy", err)
+	}
+}
+
+func TestReverseTunnelInboundRelayLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  cloudbridge.Option
+		data []byte
+		idle bool // whether the connection is expected to time out
+	}{
+		{
+			name: "upload",
+			opt: cloudbridge.WithInboundTunnelLimits(cloudbridge.TunnelLimits{
+				SessionRate: cloudbridge.RateLimit{Upload: 16 << 10},
+			}),
+			data: make([]byte, 32<<10),
+		},
+		{
+			name: "idle timeout",
+			opt:  cloudbridge.WithInboundIdleTimeout(100 * time.Millisecond),
+			data: []byte("ping"),
+			idle: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network := memtransport.NewNetwork()
+			alice := newTestClient(t, network, "alice")
+
+			remotePort := freePort(t)
+			bob, err := cloudbridge.NewClient(
+				cloudbridge.WithToken("test-token"),
+				cloudbridge.WithTransport(newTestTransport(network, "bob")),
+				cloudbridge.WithTunnelPolicy(cloudbridge.TunnelPolicy{Rules: []cloudbridge.TunnelRule{
+					{PeerIDs: []string{"alice"}, ListenPorts: []int{remotePort}},
+				}}),
+				tt.opt,
+			)
+			if err != nil {
+				t.Fatalf("Failed to create client bob: %v", err)
+			}
+			t.Cleanup(func() { bob.Close() })
+			serve(t, network, bob, "bob")
+
+			tunnel, err := alice.CreateReverseTunnel(context.Background(), cloudbridge.ReverseTunnelConfig{
+				RemotePeer: "bob",
+				RemotePort: remotePort,
+				LocalPort:  startEchoServer(t),
+			})
+			if err != nil {
+				t.Fatalf("CreateReverseTunnel() error = %v", err)
+			}
+			defer tunnel.Close()
+
+			conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(remotePort)))
+			if err != nil {
+				t.Fatalf("Failed to dial reverse tunnel: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			start := time.Now()
+			go conn.Write(tt.data)
+			if _, err := io.ReadFull(conn, make([]byte, len(tt.data))); err != nil {
+				t.Fatalf("ReadFull() error = %v", err)
+			}
+			if !tt.idle {
+				// One second of burst, then one second at the limit
+				if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+					t.Errorf("32KiB at 16KiB/s took %v, want about 1s", elapsed)
+				}
+				return
+			}
+
+			start = time.Now()
+			if _, err := conn.Read(make([]byte, 1)); err == nil {
+				t.Error("Read() on idle connection should fail")
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("idle connection closed after %v, want about 100ms", elapsed)
+			}
+		})
+	}
+}
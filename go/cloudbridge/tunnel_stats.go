@@ -0,0 +1,128 @@
+package cloudbridge
+
+import (
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Tunnel error categories used in TunnelStats.Errors
+const (
+	TunnelErrorAccept    = "accept"    // accepting local connections
+	TunnelErrorConnect   = "connect"   // opening a stream to the remote peer
+	TunnelErrorHandshake = "handshake" // remote peer rejected or failed the handshake
+	TunnelErrorTransfer  = "transfer"  // copying data in either direction
+	TunnelErrorLimit     = "limit"     // sessions rejected by MaxSessions
+)
+
+// TunnelStats is a snapshot of tunnel activity.
+// Bytes in are received from the remote peer, bytes out are sent to it.
+type TunnelStats struct {
+	ActiveSessions int
+	TotalSessions  int64
+	BytesIn        int64
+	BytesOut       int64
+	Errors         map[string]int64
+	Sessions       []TunnelSessionStats
+}
+
+// TunnelSessionStats describes one active forwarded connection
+type TunnelSessionStats struct {
+	ID         uint64
+	ClientAddr string
+	StartedAt  time.Time
+	Duration   time.Duration
+	BytesIn    int64
+	BytesOut   int64
+}
+
+// tunnelSession tracks one forwarded connection
+type tunnelSession struct {
+	id         uint64
+	conn       io.Closer
+	clientAddr string
+	startedAt  time.Time
+	bytesIn    atomic.Int64
+	bytesOut   atomic.Int64
+}
+
+// tunnelCounters holds the cumulative tunnel statistics
+type tunnelCounters struct {
+	totalSessions atomic.Int64
+	bytesIn       atomic.Int64
+	bytesOut      atomic.Int64
+	errors        map[string]*atomic.Int64
+}
+
+// newTunnelCounters creates counters for every error category
+func newTunnelCounters() *tunnelCounters {
+	return &tunnelCounters{
+		errors: map[string]*atomic.Int64{
+			TunnelErrorAccept:    new(atomic.Int64),
+			TunnelErrorConnect:   new(atomic.Int64),
+			TunnelErrorHandshake: new(atomic.Int64),
+			TunnelErrorTransfer:  new(atomic.Int64),
+			TunnelErrorLimit:     new(atomic.Int64),
+		},
+	}
+}
+
+// recordError counts an error in the given category
+func (c *tunnelCounters) recordError(category string) {
+	c.errors[category].Add(1)
+}
+
+// Stats returns a snapshot of the tunnel activity
+func (t *tunnel) Stats() TunnelStats {
+	if t.counters == nil {
+		// Never started
+		return TunnelStats{Errors: map[string]int64{}}
+	}
+
+	stats := TunnelStats{
+		TotalSessions: t.counters.totalSessions.Load(),
+		BytesIn:       t.counters.bytesIn.Load(),
+		BytesOut:      t.counters.bytesOut.Load(),
+		Errors:        make(map[string]int64, len(t.counters.errors)),
+	}
+
+	for category, n := range t.counters.errors {
+		stats.Errors[category] = n.Load()
+	}
+
+	now := time.Now()
+	t.mu.RLock()
+	for _, s := range t.active {
+		stats.Sessions = append(stats.Sessions, TunnelSessionStats{
+			ID:         s.id,
+			ClientAddr: s.clientAddr,
+			StartedAt:  s.startedAt,
+			Duration:   now.Sub(s.startedAt),
+			BytesIn:    s.bytesIn.Load(),
+			BytesOut:   s.bytesOut.Load(),
+		})
+	}
+	t.mu.RUnlock()
+
+	sort.Slice(stats.Sessions, func(i, j int) bool {
+		return stats.Sessions[i].ID < stats.Sessions[j].ID
+	})
+	stats.ActiveSessions = len(stats.Sessions)
+
+	return stats
+}
+
+// countingWriter adds the number of bytes written to each counter
+type countingWriter struct {
+	w        io.Writer
+	counters []*atomic.Int64
+}
+
+func (c countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	for _, counter := range c.counters {
+		counter.Add(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,131 @@
+package cloudbridge_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+func TestTunnelStats(t *testing.T) {
+	tunnel, conn, _ := openTunnel(t, 0)
+
+	waitFor(t, "bytes to be counted", func() bool {
+		stats := tunnel.Stats()
+		return stats.BytesIn == 4 && stats.BytesOut == 4
+	})
+
+	stats := tunnel.Stats()
+	if stats.ActiveSessions != 1 || stats.TotalSessions != 1 {
+		t.Errorf("Stats() sessions = %d active, %d total, want 1, 1", stats.ActiveSessions, stats.TotalSessions)
+	}
+	if len(stats.Sessions) != 1 {
+		t.Fatalf("Stats().Sessions = %d entries, want 1", len(stats.Sessions))
+	}
+
+	session := stats.Sessions[0]
+	if session.ClientAddr != conn.LocalAddr().String() {
+		t.Errorf("ClientAddr = %v, want %v", session.ClientAddr, conn.LocalAddr())
+	}
+	if session.BytesIn != 4 || session.BytesOut != 4 {
+		t.Errorf("session bytes = %d in, %d out, want 4, 4", session.BytesIn, session.BytesOut)
+	}
+	if session.StartedAt.IsZero() || session.Duration <= 0 {
+		t.Errorf("session StartedAt = %v, Duration = %v", session.StartedAt, session.Duration)
+	}
+
+	conn.Close()
+	waitFor(t, "session to end", func() bool {
+		return tunnel.Stats().ActiveSessions == 0
+	})
+
+	stats = tunnel.Stats()
+	if stats.TotalSessions != 1 || stats.BytesOut != 4 {
+		t.Errorf("Stats() after close = %+v, want totals kept", stats)
+	}
+	for category, n := range stats.Errors {
+		if n != 0 {
+			t.Errorf("Errors[%s] = %d, want 0", category, n)
+		}
+	}
+}
+
+func TestTunnelStatsHandshakeError(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+	serve(t, network, bob, "bob")
+
+	localPort := freePort(t)
+	tunnel, err := alice.CreateTunnel(context.Background(), cloudbridge.TunnelConfig{
+		LocalPort:  localPort,
+		RemotePeer: "bob",
+		RemotePort: freePort(t),
+	})
+	if err != nil {
+		t.Fatalf("CreateTunnel() error = %v", err)
+	}
+	defer tunnel.Close()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort)))
+	if err != nil {
+		t.Fatalf("Failed to dial tunnel: %v", err)
+	}
+	defer conn.Close()
+
+	waitFor(t, "handshake error", func() bool {
+		return tunnel.Stats().Errors[cloudbridge.TunnelErrorHandshake] == 1
+	})
+}
+
+// stallingTransport never completes ConnectToPeer, like an unreachable peer
+type stallingTransport struct {
+	*memtransport.Transport
+}
+
+func (s stallingTransport) ConnectToPeer(ctx context.Context, peerID string) (cloudbridge.Stream, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestTunnelStatsConnectTimeout(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice, err := cloudbridge.NewClient(
+		cloudbridge.WithToken("test-token"),
+		cloudbridge.WithTimeout(100*time.Millisecond),
+		cloudbridge.WithTransport(stallingTransport{network.NewTransport("alice")}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer alice.Close()
+
+	localPort := freePort(t)
+	tunnel, err := alice.CreateTunnel(context.Background(), cloudbridge.TunnelConfig{
+		LocalPort:  localPort,
+		RemotePeer: "bob",
+		RemotePort: freePort(t),
+	})
+	if err != nil {
+		t.Fatalf("CreateTunnel() error = %v", err)
+	}
+	defer tunnel.Close()
+
+	// Each connection gives up after the client timeout instead of
+	// waiting behind the dial of the one before it
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort)))
+		if err != nil {
+			t.Fatalf("Failed to dial tunnel: %v", err)
+		}
+		defer conn.Close()
+	}
+
+	waitFor(t, "connect errors", func() bool {
+		return tunnel.Stats().Errors[cloudbridge.TunnelErrorConnect] == 3
+	})
+}
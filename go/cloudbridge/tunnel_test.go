@@ -33,6 +33,16 @@ func TestTunnelConfigValidate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid UDP config",
+			config: TunnelConfig{
+				LocalPort:  5353,
+				RemotePeer: "peer-123",
+				RemotePort: 53,
+				Protocol:   ProtocolUDP,
+			},
+			wantErr: false,
+		},
 		{
 			name: "default protocol (TCP)",
 			config: TunnelConfig{
@@ -44,12 +54,50 @@ func TestTunnelConfigValidate(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name: "invalid local port - zero",
+			name: "ephemeral local port",
 			config: TunnelConfig{
 				LocalPort:  0,
 				RemotePeer: "peer-123",
 				RemotePort: 3000,
 			},
+			wantErr: false,
+		},
+		{
+			name: "loopback bind address",
+			config: TunnelConfig{
+				LocalAddr:  "127.0.0.1",
+				LocalPort:  8080,
+				RemotePeer: "peer-123",
+				RemotePort: 3000,
+			},
+			wantErr: false,
+		},
+		{
+			name: "unix socket",
+			config: TunnelConfig{
+				LocalAddr:  "unix:/tmp/tunnel.sock",
+				RemotePeer: "peer-123",
+				RemotePort: 3000,
+			},
+			wantErr: false,
+		},
+		{
+			name: "unix socket without path",
+			config: TunnelConfig{
+				LocalAddr:  "unix:",
+				RemotePeer: "peer-123",
+				RemotePort: 3000,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unix socket for UDP",
+			config: TunnelConfig{
+				LocalAddr:  "unix:/tmp/tunnel.sock",
+				RemotePeer: "peer-123",
+				RemotePort: 53,
+				Protocol:   ProtocolUDP,
+			},
 			wantErr: true,
 		},
 		{
@@ -97,6 +145,26 @@ func TestTunnelConfigValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid remote host",
+			config: TunnelConfig{
+				LocalPort:  5432,
+				RemotePeer: "peer-123",
+				RemoteHost: "10.0.0.5",
+				RemotePort: 5432,
+			},
+			wantErr: false,
+		},
+		{
+			name: "remote host with port",
+			config: TunnelConfig{
+				LocalPort:  5432,
+				RemotePeer: "peer-123",
+				RemoteHost: "10.0.0.5:5432",
+				RemotePort: 5432,
+			},
+			wantErr: true,
+		},
 		{
 			name: "invalid protocol",
 			config: TunnelConfig{
@@ -107,6 +175,52 @@ func TestTunnelConfigValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid limits",
+			config: TunnelConfig{
+				LocalPort:   8080,
+				RemotePeer:  "peer-123",
+				RemotePort:  3000,
+				IdleTimeout: time.Minute,
+				Limits: TunnelLimits{
+					Rate:          RateLimit{Upload: 1 << 20, Download: 1 << 20},
+					SessionRate:   RateLimit{Upload: 1 << 16},
+					MaxSessions:   10,
+					QueueSessions: true,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative idle timeout",
+			config: TunnelConfig{
+				LocalPort:   8080,
+				RemotePeer:  "peer-123",
+				RemotePort:  3000,
+				IdleTimeout: -time.Second,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative rate limit",
+			config: TunnelConfig{
+				LocalPort:  8080,
+				RemotePeer: "peer-123",
+				RemotePort: 3000,
+				Limits:     TunnelLimits{SessionRate: RateLimit{Download: -1}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative max sessions",
+			config: TunnelConfig{
+				LocalPort:  8080,
+				RemotePeer: "peer-123",
+				RemotePort: 3000,
+				Limits:     TunnelLimits{MaxSessions: -1},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -155,6 +269,23 @@ func TestTunnelRemotePort(t *testing.T) {
 	}
 }
 
+func TestTunnelRemoteHost(t *testing.T) {
+	config := TunnelConfig{
+		LocalPort:  8080,
+		RemotePeer: "peer-123",
+		RemotePort: 3000,
+	}
+
+	if err := config.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+
+	tunnel := &tunnel{config: config}
+	if tunnel.RemoteHost() != "localhost" {
+		t.Errorf("RemoteHost() = %v, want %v", tunnel.RemoteHost(), "localhost")
+	}
+}
+
 func TestTunnelClose(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -0,0 +1,285 @@
+package cloudbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UDP tunnels carry each datagram as one message frame on a session stream.
+// Every source address gets its own stream, so replies from the remote
+// service are delivered back to the client that sent the request. Rate
+// limits delay whole datagrams; a flow that falls behind drops them.
+const (
+	defaultUDPIdleTimeout = 60 * time.Second
+
+	// maxDatagramSize is the largest UDP payload
+	maxDatagramSize = 65535
+
+	// udpQueueSize is the number of datagrams buffered per flow while its
+	// stream is being opened; further datagrams are dropped
+	udpQueueSize = 64
+)
+
+// startUDP binds the local UDP socket and starts forwarding datagrams
+func (t *tunnel) startUDP() error {
+	conn, err := net.ListenPacket(t.config.listenAddress())
+	if err != nil {
+		t.cancel()
+		return fmt.Errorf("failed to start listener: %w", err)
+	}
+
+	t.listener = conn
+	t.bound(conn.LocalAddr())
+	t.flows = make(map[string]*udpFlow)
+
+	t.wg.Add(1)
+	go t.readLoop(conn)
+
+	return nil
+}
+
+// readLoop dispatches local datagrams to per-source flows
+func (t *tunnel) readLoop(conn net.PacketConn) {
+	defer t.wg.Done()
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.mu.RLock()
+			closed := t.closed
+			t.mu.RUnlock()
+			if !closed {
+				t.counters.recordError(TunnelErrorAccept)
+				fmt.Printf("failed to read datagram: %v\n", err)
+			}
+			return
+		}
+
+		flow := t.flowFor(conn, addr)
+		if flow == nil {
+			continue
+		}
+
+		select {
+		case flow.queue <- append([]byte(nil), buf[:n]...):
+		default:
+			// The flow is not keeping up; drop like the network would
+			t.counters.recordError(TunnelErrorTransfer)
+		}
+	}
+}
+
+// flowFor returns the flow for addr, starting one if needed.
+// It returns nil if the flow was rejected or the tunnel is closed.
+func (t *tunnel) flowFor(conn net.PacketConn, addr net.Addr) *udpFlow {
+	key := addr.String()
+
+	t.mu.RLock()
+	flow := t.flows[key]
+	t.mu.RUnlock()
+	if flow != nil {
+		return flow
+	}
+
+	flow = &udpFlow{
+		tunnel: t,
+		conn:   conn,
+		addr:   addr,
+		queue:  make(chan []byte, udpQueueSize),
+		done:   make(chan struct{}),
+	}
+
+	// A full tunnel drops datagrams from new sources
+	flow.session = t.admit(flow, key, false)
+	if flow.session == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	t.flows[key] = flow
+	t.mu.Unlock()
+
+	flow.idle = newIdleTimer(t.config.IdleTimeout, func() { flow.Close() })
+	go flow.run()
+
+	return flow
+}
+
+// udpFlow forwards the datagrams of one local source address
+type udpFlow struct {
+	tunnel    *tunnel
+	conn      net.PacketConn
+	addr      net.Addr
+	session   *tunnelSession
+	queue     chan []byte
+	idle      *idleTimer
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// run opens the flow stream and forwards datagrams until the flow closes
+func (f *udpFlow) run() {
+	t := f.tunnel
+	defer t.untrack(f.session)
+	defer f.remove()
+	defer f.idle.stop()
+
+	options := map[string]string{optIdleTimeout: t.config.IdleTimeout.String()}
+	stream, err := t.openTarget(t.ctx, StreamKindUDP, options)
+	if err != nil {
+		return
+	}
+	defer stream.Close()
+
+	limits := t.limiter.session(0)
+
+	// Remote peer to local client
+	go func() {
+		defer f.Close()
+		for {
+			datagram, _, err := readFrame(stream, maxDatagramSize)
+			if err != nil {
+				return
+			}
+			f.idle.touch()
+
+			if err := waitBuckets(t.ctx, limits.down, len(datagram)); err != nil {
+				return
+			}
+			n, err := f.conn.WriteTo(datagram, f.addr)
+			if err != nil {
+				return
+			}
+			f.session.bytesIn.Add(int64(n))
+			t.counters.bytesIn.Add(int64(n))
+		}
+	}()
+
+	// Local client to remote peer
+	for {
+		select {
+		case <-f.done:
+			return
+		case datagram := <-f.queue:
+			f.idle.touch()
+			if err := waitBuckets(t.ctx, limits.up, len(datagram)); err != nil {
+				return
+			}
+			if _, err := writeFrame(stream, datagram); err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					t.counters.recordError(TunnelErrorTransfer)
+				}
+				return
+			}
+			f.session.bytesOut.Add(int64(len(datagram)))
+			t.counters.bytesOut.Add(int64(len(datagram)))
+		}
+	}
+}
+
+// remove unregisters the flow so the next datagram from its source
+// starts a new one
+func (f *udpFlow) remove() {
+	t := f.tunnel
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.flows[f.addr.String()] == f {
+		delete(t.flows, f.addr.String())
+	}
+}
+
+// Close stops the flow
+func (f *udpFlow) Close() error {
+	f.closeOnce.Do(func() {
+		close(f.done)
+	})
+	return nil
+}
+
+// serveUDP forwards datagrams between an incoming UDP tunnel stream from
+// peerID and its local target
+func (c *Client) serveUDP(stream io.ReadWriteCloser, req handshakeRequest, peerID string) {
+	if !c.checkTunnelTarget(stream, req, peerID) {
+		return
+	}
+
+	if !c.admitInbound(stream) {
+		return
+	}
+	defer c.inbound.release()
+
+	localConn, err := net.Dial("udp", req.Target)
+	if err != nil {
+		rejectHandshake(stream, HandshakeTargetUnreachable, err.Error())
+		return
+	}
+	defer localConn.Close()
+
+	idleTimeout := defaultUDPIdleTimeout
+	if d, err := time.ParseDuration(req.Options[optIdleTimeout]); err == nil && d > 0 {
+		idleTimeout = d
+	}
+	if limit := c.config.InboundIdleTimeout; limit > 0 && limit < idleTimeout {
+		idleTimeout = limit
+	}
+
+	if err := writeHandshakeResponse(stream, HandshakeOK, ""); err != nil {
+		fmt.Printf("failed to acknowledge UDP tunnel: %v\n", err)
+		return
+	}
+
+	limits := c.inbound.session(0)
+
+	var lastActive atomic.Int64
+	lastActive.Store(time.Now().UnixNano())
+
+	// Remote peer to local service; closing either side ends the flow
+	go func() {
+		defer localConn.Close()
+		for {
+			datagram, _, err := readFrame(stream, maxDatagramSize)
+			if err != nil {
+				return
+			}
+			lastActive.Store(time.Now().UnixNano())
+			waitBuckets(context.Background(), limits.down, len(datagram))
+			localConn.Write(datagram)
+		}
+	}()
+
+	// Local service to remote peer
+	buf := make([]byte, maxDatagramSize)
+	for {
+		localConn.SetReadDeadline(time.Now().Add(idleTimeout))
+		n, err := localConn.Read(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if time.Since(time.Unix(0, lastActive.Load())) < idleTimeout {
+				continue
+			}
+			return
+		}
+		if err != nil {
+			// ICMP port unreachable surfaces as a read error; keep waiting
+			// for the service to come up unless the flow was closed
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		lastActive.Store(time.Now().UnixNano())
+		waitBuckets(context.Background(), limits.up, n)
+		if _, err := writeFrame(stream, buf[:n]); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package cloudbridge_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge/memtransport"
+)
+
+// startUDPEchoServer starts a UDP echo server on a loopback port
+func startUDPEchoServer(t *testing.T) int {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start UDP echo server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// freeUDPPort returns a currently unused UDP port
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestUDPTunnel(t *testing.T) {
+	network := memtransport.NewNetwork()
+	alice := newTestClient(t, network, "alice")
+	bob := newTestClient(t, network, "bob")
+	serve(t, network, bob, "bob")
+
+	localPort := freeUDPPort(t)
+	tunnel, err := alice.CreateTunnel(context.Background(), cloudbridge.TunnelConfig{
+		LocalPort:   localPort,
+		RemotePeer:  "bob",
+		RemotePort:  startUDPEchoServer(t),
+		Protocol:    cloudbridge.ProtocolUDP,
+		IdleTimeout: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("CreateTunnel() error = %v", err)
+	}
+	defer tunnel.Close()
+
+	// Each source address gets its own session and its own replies
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort))
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("udp", addr)
+		if err != nil {
+			t.Fatalf("Failed to dial tunnel: %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		for j := 0; j < 3; j++ {
+			msg := fmt.Sprintf("client %d datagram %d", i, j)
+			if _, err := conn.Write([]byte(msg)); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			buf := make([]byte, 64)
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if got := string(buf[:n]); got != msg {
+				t.Errorf("Read() = %q, want %q", got, msg)
+			}
+		}
+	}
+
+	stats := tunnel.Stats()
+	if stats.TotalSessions != 2 {
+		t.Errorf("TotalSessions = %d, want 2", stats.TotalSessions)
+	}
+
+	// Idle sessions are closed
+	waitFor(t, "idle sessions to close", func() bool {
+		return tunnel.Stats().ActiveSessions == 0
+	})
+}
+
+func TestUDPTunnelRateLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits cloudbridge.TunnelLimits
+		opts   []cloudbridge.Option
+	}{
+		{
+			name:   "tunnel upload",
+			limits: cloudbridge.TunnelLimits{Rate: cloudbridge.RateLimit{Upload: 16 << 10}},
+		},
+		{
+			name: "inbound upload",
+			opts: []cloudbridge.Option{cloudbridge.WithInboundTunnelLimits(cloudbridge.TunnelLimits{
+				SessionRate: cloudbridge.RateLimit{Upload: 16 << 10},
+			})},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network := memtransport.NewNetwork()
+			alice := newTestClient(t, network, "alice")
+			bob, err := cloudbridge.NewClient(append([]cloudbridge.Option{
+				cloudbridge.WithToken("test-token"),
+				cloudbridge.WithTransport(newTestTransport(network, "bob")),
+			}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("Failed to create client bob: %v", err)
+			}
+			t.Cleanup(func() { bob.Close() })
+			serve(t, network, bob, "bob")
+
+			tunnel, err := alice.CreateTunnel(context.Background(), cloudbridge.TunnelConfig{
+				LocalAddr:   "127.0.0.1",
+				RemotePeer:  "bob",
+				RemotePort:  startUDPEchoServer(t),
+				Protocol:    cloudbridge.ProtocolUDP,
+				Limits:      tt.limits,
+				GracePeriod: -1,
+			})
+			if err != nil {
+				t.Fatalf("CreateTunnel() error = %v", err)
+			}
+			defer tunnel.Close()
+
+			conn, err := net.Dial("udp", tunnel.LocalAddr().String())
+			if err != nil {
+				t.Fatalf("Failed to dial tunnel: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			// One second of burst, then one second at the limit
+			start := time.Now()
+			datagram := make([]byte, 1<<10)
+			for i := 0; i < 32; i++ {
+				if _, err := conn.Write(datagram); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			for i := 0; i < 32; i++ {
+				if _, err := conn.Read(datagram); err != nil {
+					t.Fatalf("Read() of reply %d error = %v", i, err)
+				}
+			}
+			if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+				t.Errorf("32KiB at 16KiB/s took %v, want about 1s", elapsed)
+			}
+		})
+	}
+}
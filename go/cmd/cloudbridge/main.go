@@ -37,6 +37,7 @@ func init() {
 	rootCmd.AddCommand(connectCmd)
 	rootCmd.AddCommand(discoverCmd)
 	rootCmd.AddCommand(tunnelCmd)
+	rootCmd.AddCommand(socksCmd)
 	rootCmd.AddCommand(healthCmd)
 	rootCmd.AddCommand(versionCmd)
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
+)
+
+var (
+	socksListenAddr string
+	socksGateway    string
+)
+
+var socksCmd = &cobra.Command{
+	Use:   "socks",
+	Short: "Run a SOCKS5 proxy over the peer mesh",
+	Long: `Run a local SOCKS5 proxy that forwards connections through CloudBridge.
+Peer addresses such as <peer-id>.cb:<port> or <service>.<peer-id>.cb go to
+that peer; other hosts go through the gateway peer, if one is set.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logVerbose("Creating CloudBridge client...")
+		client, err := createClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		var opts []cloudbridge.ProxyOption
+		if socksGateway != "" {
+			opts = append(opts, cloudbridge.WithGatewayPeer(socksGateway))
+		}
+
+		fmt.Printf("✓ SOCKS5 proxy listening on %s\n", socksListenAddr)
+		if socksGateway != "" {
+			fmt.Printf("  Gateway peer: %s\n", socksGateway)
+		}
+		fmt.Println("\nPress Ctrl+C to stop the proxy")
+
+		if err := client.ServeSOCKS5(ctx, socksListenAddr, opts...); err != nil {
+			return fmt.Errorf("SOCKS5 proxy failed: %w", err)
+		}
+
+		fmt.Println("\nShutting down proxy...")
+		return nil
+	},
+}
+
+func init() {
+	socksCmd.Flags().StringVarP(&socksListenAddr, "listen", "l", "localhost:1080", "Local address to listen on")
+	socksCmd.Flags().StringVarP(&socksGateway, "gateway", "g", "", "Peer that connects to hosts outside the .cb domain")
+}
@@ -6,16 +6,25 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/twogc/cloudbridge-sdk/go/cloudbridge"
 )
 
 var (
 	tunnelLocalAddr  string
 	tunnelRemoteAddr string
 	tunnelProtocol   string
+
+	tunnelUploadLimit   int64
+	tunnelDownloadLimit int64
+	tunnelMaxSessions   int
+	tunnelQueue         bool
+	tunnelIdleTimeout   time.Duration
 )
 
 var tunnelCmd = &cobra.Command{
@@ -34,6 +43,21 @@ The tunnel forwards local traffic to a remote address through the peer.`,
 			return fmt.Errorf("remote address is required (--remote)")
 		}
 
+		// A Unix socket path, or host:port with port 0 for any free port
+		localHost, localPort := tunnelLocalAddr, 0
+		var err error
+		if !strings.HasPrefix(tunnelLocalAddr, "unix:") {
+			localHost, localPort, err = splitHostPort(tunnelLocalAddr)
+			if err != nil {
+				return fmt.Errorf("invalid local address: %w", err)
+			}
+		}
+
+		remoteHost, remotePort, err := splitHostPort(tunnelRemoteAddr)
+		if err != nil {
+			return fmt.Errorf("invalid remote address: %w", err)
+		}
+
 		logVerbose("Creating CloudBridge client...")
 		client, err := createClient()
 		if err != nil {
@@ -44,104 +68,72 @@ The tunnel forwards local traffic to a remote address through the peer.`,
 		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 		defer cancel()
 
-		_ = ctx // Will be used for actual tunnel creation
-
 		fmt.Printf("Creating %s tunnel to peer: %s\n", tunnelProtocol, peerID)
 		fmt.Printf("  Local:  %s\n", tunnelLocalAddr)
 		fmt.Printf("  Remote: %s\n", tunnelRemoteAddr)
 
-		// Create tunnel configuration
-		// In real implementation, this would call client.CreateTunnel(ctx, tunnelConfig)
 		logVerbose("Establishing tunnel...")
-
-		// Start local listener
-		listener, err := net.Listen("tcp", tunnelLocalAddr)
+		tunnel, err := client.CreateTunnel(ctx, cloudbridge.TunnelConfig{
+			LocalAddr:  localHost,
+			LocalPort:  localPort,
+			RemotePeer: peerID,
+			RemoteHost: remoteHost,
+			RemotePort: remotePort,
+			Protocol:   cloudbridge.Protocol(tunnelProtocol),
+
+			IdleTimeout: tunnelIdleTimeout,
+			Limits: cloudbridge.TunnelLimits{
+				Rate:          cloudbridge.RateLimit{Upload: tunnelUploadLimit, Download: tunnelDownloadLimit},
+				MaxSessions:   tunnelMaxSessions,
+				QueueSessions: tunnelQueue,
+			},
+		})
 		if err != nil {
-			return fmt.Errorf("failed to start local listener: %w", err)
+			return fmt.Errorf("failed to create tunnel: %w", err)
 		}
-		defer listener.Close()
+		defer tunnel.Close()
 
 		fmt.Printf("✓ Tunnel established\n")
-		fmt.Printf("  Listening on: %s\n", tunnelLocalAddr)
+		fmt.Printf("  Listening on: %s\n", tunnel.LocalAddr())
 		fmt.Println("\nPress Ctrl+C to stop the tunnel")
 
-		// Setup signal handling
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+		<-sigChan
 
-		// Accept connections in goroutine
-		connChan := make(chan net.Conn)
-		errChan := make(chan error, 1)
-
-		go func() {
-			for {
-				conn, err := listener.Accept()
-				if err != nil {
-					errChan <- err
-					return
-				}
-				connChan <- conn
-			}
-		}()
-
-		connectionCount := 0
-
-		for {
-			select {
-			case <-sigChan:
-				fmt.Println("\nShutting down tunnel...")
-				fmt.Printf("Total connections handled: %d\n", connectionCount)
-				return nil
-
-			case conn := <-connChan:
-				connectionCount++
-				fmt.Printf("[%s] New connection from %s (total: %d)\n",
-					time.Now().Format("15:04:05"),
-					conn.RemoteAddr(),
-					connectionCount,
-				)
-
-				// Handle connection in goroutine
-				go handleTunnelConnection(conn, peerID, tunnelRemoteAddr)
-
-			case err := <-errChan:
-				return fmt.Errorf("listener error: %w", err)
-			}
-		}
+		fmt.Println("\nShutting down tunnel...")
+		stats := tunnel.Stats()
+		fmt.Printf("Total sessions handled: %d\n", stats.TotalSessions)
+		fmt.Printf("  Bytes sent:     %d\n", stats.BytesOut)
+		fmt.Printf("  Bytes received: %d\n", stats.BytesIn)
+		fmt.Printf("  Rejected:       %d\n", stats.Errors[cloudbridge.TunnelErrorLimit])
+
+		return nil
 	},
 }
 
 func init() {
-	tunnelCmd.Flags().StringVarP(&tunnelLocalAddr, "local", "l", "", "Local address to listen on (e.g., localhost:8080)")
-	tunnelCmd.Flags().StringVarP(&tunnelRemoteAddr, "remote", "r", "", "Remote address to forward to (e.g., localhost:80)")
+	tunnelCmd.Flags().StringVarP(&tunnelLocalAddr, "local", "l", "", "Local address to listen on (e.g., localhost:8080, localhost:0 or unix:/tmp/db.sock)")
+	tunnelCmd.Flags().StringVarP(&tunnelRemoteAddr, "remote", "r", "", "Remote address the peer forwards to (e.g., localhost:80 or 10.0.0.5:5432)")
 	tunnelCmd.Flags().StringVarP(&tunnelProtocol, "protocol", "p", "tcp", "Protocol (tcp or udp)")
+	tunnelCmd.Flags().Int64Var(&tunnelUploadLimit, "upload-limit", 0, "Maximum bytes per second sent to the peer (0 for no limit)")
+	tunnelCmd.Flags().Int64Var(&tunnelDownloadLimit, "download-limit", 0, "Maximum bytes per second received from the peer (0 for no limit)")
+	tunnelCmd.Flags().IntVar(&tunnelMaxSessions, "max-sessions", 0, "Maximum concurrent connections (0 for no limit)")
+	tunnelCmd.Flags().BoolVar(&tunnelQueue, "queue", false, "Queue connections over --max-sessions instead of rejecting them")
+	tunnelCmd.Flags().DurationVar(&tunnelIdleTimeout, "idle-timeout", 0, "Close connections idle for this long (0 for the protocol default)")
 }
 
-func handleTunnelConnection(conn net.Conn, peerID, remoteAddr string) {
-	defer conn.Close()
-
-	logVerbose("Handling connection from %s", conn.RemoteAddr())
-
-	// In real implementation, this would:
-	// 1. Get or create peer connection
-	// 2. Send tunnel request to peer with remote address
-	// 3. Forward data bidirectionally between local conn and peer tunnel
-
-	// For now, just simulate with a timeout
-	fmt.Printf("[%s] Forwarding %s -> %s (via %s)\n",
-		time.Now().Format("15:04:05"),
-		conn.RemoteAddr(),
-		remoteAddr,
-		peerID,
-	)
+// splitHostPort splits a host:port address and parses the port
+func splitHostPort(addr string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
 
-	// Simulate data transfer
-	buffer := make([]byte, 4096)
-	_, err := conn.Read(buffer)
+	port, err := strconv.Atoi(portStr)
 	if err != nil {
-		logVerbose("Connection closed: %v", err)
-		return
+		return "", 0, fmt.Errorf("invalid port %q", portStr)
 	}
 
-	logVerbose("Data forwarded successfully")
+	return host, port, nil
 }
@@ -4,6 +4,7 @@ go 1.25.3
 
 require (
 	github.com/2gc-dev/relay-client v1.4.20
+	github.com/hashicorp/yamux v0.1.2
 	github.com/quic-go/quic-go v0.55.0
 	github.com/spf13/cobra v1.10.1
 )